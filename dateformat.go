@@ -0,0 +1,112 @@
+package filemaker
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// DateFormat is the format of the dates, times and timestamps in the field data and find
+// criteria of the requests and responses of a session, sent as the `dateformats` parameter
+type DateFormat int
+
+const (
+	// DateFormatUS formats dates as MM/dd/yyyy, which is the default of the Data API
+	DateFormatUS DateFormat = 0
+	// DateFormatFileLocale formats dates using the locale of the database file, whose layouts
+	// must be specified with WithDateLayouts
+	DateFormatFileLocale DateFormat = 1
+	// DateFormatISO8601 formats dates as yyyy-MM-dd
+	DateFormatISO8601 DateFormat = 2
+)
+
+// dateLayouts holds the Go time layouts of the date, time and timestamp fields of a session
+type dateLayouts struct {
+	date      string
+	time      string
+	timestamp string
+}
+
+// defaultDateLayouts are the layouts of the US date format, used by requests without the
+// `dateformats` parameter
+var defaultDateLayouts = dateLayouts{dateLayout, timeLayout, timestampLayout}
+
+// timeLayouts returns the layouts of the date, time and timestamp fields of the session, falling
+// back to the layouts of the date format for any layouts not specified with WithDateLayouts
+func (s *Session) timeLayouts() dateLayouts {
+	layouts := defaultDateLayouts
+	if s == nil {
+		return layouts
+	}
+
+	if s.dateFormat == DateFormatISO8601 {
+		layouts = dateLayouts{"2006-01-02", timeLayout, "2006-01-02 15:04:05"}
+	}
+	if s.layouts.date != "" {
+		layouts.date = s.layouts.date
+	}
+	if s.layouts.time != "" {
+		layouts.time = s.layouts.time
+	}
+	if s.layouts.timestamp != "" {
+		layouts.timestamp = s.layouts.timestamp
+	}
+
+	return layouts
+}
+
+// formatValue converts the value the same way as normalizeValue, additionally formatting
+// time.Time values as timestamps using the specified layouts
+func formatValue(value interface{}, layouts dateLayouts) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return formatTime(t, layouts.timestamp)
+	}
+
+	return normalizeValue(value)
+}
+
+// formatTime formats the time using the layout, with zero times formatted as empty fields
+func formatTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// checkDateFormat returns an error if the layouts of the date format are unknown, which is the
+// case for DateFormatFileLocale unless all layouts are specified with WithDateLayouts
+func (s *Session) checkDateFormat() error {
+	if s.dateFormat == DateFormatFileLocale &&
+		(s.layouts.date == "" || s.layouts.time == "" || s.layouts.timestamp == "") {
+		return errors.New("DateFormatFileLocale requires the date, time and timestamp layouts of WithDateLayouts")
+	}
+	return nil
+}
+
+// hasDateFormat returns true if the `dateformats` parameter should be sent with requests
+func (s *Session) hasDateFormat() bool {
+	return s != nil && s.dateFormat != DateFormatUS
+}
+
+// withDateFormat appends the `dateformats` parameter of the session to the getoptions
+func (s *Session) withDateFormat(options []GetOptions) []GetOptions {
+	if !s.hasDateFormat() {
+		return options
+	}
+	return append(options, GetOptions{"dateformats": int(s.dateFormat)})
+}
+
+// withDateFormatBody adds the `dateformats` parameter of the session to the json object body
+func (s *Session) withDateFormatBody(body []byte) ([]byte, error) {
+	if !s.hasDateFormat() {
+		return body, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, err
+	}
+	object["dateformats"], _ = json.Marshal(int(s.dateFormat))
+
+	return json.Marshal(object)
+}
@@ -0,0 +1,145 @@
+package filemaker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestSessionDateFormat tests sending the dateformats parameter with requests for records
+func TestSessionDateFormat(t *testing.T) {
+	var requests []string
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.RawQuery+" "+string(b))
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"recordId":"1","modId":"0",`+
+			`"data":[{"recordId":"1","modId":"0","fieldData":{"Date":"2006-01-02"}}]}}`)
+	})
+	WithDateFormat(DateFormatISO8601)(session)
+
+	t.Run("find", func(t *testing.T) {
+		requests = nil
+		records, err := session.Find("layout", NewFindCommand(NewFindRequest(NewFindCriterion("Date", "2006-01-02"))))
+		if err != nil {
+			t.Fatalf("failed to find: %v", err)
+		}
+		expect := `POST  {"dateformats":2,"query":[{"Date":"2006-01-02"}]}`
+		if len(requests) != 1 || requests[0] != expect {
+			t.Errorf("got: %v, expected: '%v'", requests, expect)
+		}
+		if got := records[0].Time("Date", time.UTC); !got.Equal(time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("got: %v, expected: %v", got, "2006-01-02")
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		requests = nil
+		if _, err := session.GetRecord("layout", "1"); err != nil {
+			t.Fatalf("failed to get record: %v", err)
+		}
+		expect := `GET dateformats=2 `
+		if len(requests) != 1 || requests[0] != expect {
+			t.Errorf("got: %v, expected: '%v'", requests, expect)
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		record := session.NewRecord("layout")
+		record.ID = "1"
+		record.Set("Timestamp", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC))
+
+		requests = nil
+		if err := record.Commit(); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		expect := `PATCH  {"dateformats":2,"fieldData":{"Timestamp":"2006-01-02 15:04:05"}}`
+		if len(requests) == 0 || requests[0] != expect {
+			t.Errorf("got: %v, expected: '%v'", requests, expect)
+		}
+	})
+
+	t.Run("globals", func(t *testing.T) {
+		requests = nil
+		err := session.SetGlobals(map[string]interface{}{"Settings::gNow": time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)})
+		if err != nil {
+			t.Fatalf("failed to set globals: %v", err)
+		}
+		expect := `PATCH  {"globalFields":{"Settings::gNow":"01/02/2006 15:04:05"}}`
+		if len(requests) != 1 || requests[0] != expect {
+			t.Errorf("got: %v, expected: '%v'", requests, expect)
+		}
+	})
+}
+
+// TestRecordDateLayouts tests parsing and formatting field data using custom layouts
+func TestRecordDateLayouts(t *testing.T) {
+	session := &Session{}
+	WithDateFormat(DateFormatFileLocale)(session)
+	WithDateLayouts("02.01.2006", "15:04:05", "02.01.2006 15:04:05")(session)
+
+	record := session.NewRecord("layout")
+	record.FieldData["date"] = "02.01.2006"
+	record.FieldData["timestamp"] = "02.01.2006 15:04:05.250"
+	record.FieldData["time"] = "15:04:05"
+	record.FieldData["us_date"] = "01/02/2006"
+
+	tests := map[string]time.Time{
+		"date":      time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC),
+		"timestamp": time.Date(2006, 1, 2, 15, 4, 5, 250000000, time.UTC),
+		"time":      time.Date(0, 1, 1, 15, 4, 5, 0, time.UTC),
+		"us_date":   time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	for fieldName, expect := range tests {
+		t.Run(fieldName, func(t *testing.T) {
+			got, err := record.TimeE(fieldName, time.UTC)
+			if err != nil || !got.Equal(expect) {
+				t.Errorf("got: %v (%v), expected: %v", got, err, expect)
+			}
+		})
+	}
+
+	t.Run("set_date", func(t *testing.T) {
+		record.SetDate("date", tests["timestamp"])
+		record.SetTime("time", tests["timestamp"])
+		record.SetDate("zero", time.Time{})
+		expect := map[string]interface{}{"date": "02.01.2006", "time": "15:04:05", "zero": ""}
+		for fieldName, value := range expect {
+			if got := record.StagedChanges[fieldName]; got != value {
+				t.Errorf("%v: got: %v, expected: %v", fieldName, got, value)
+			}
+		}
+	})
+
+	t.Run("set_from", func(t *testing.T) {
+		value := struct {
+			Date      time.Time `fm:"date,date"`
+			Timestamp time.Time `fm:"timestamp"`
+		}{tests["timestamp"], tests["timestamp"]}
+		if err := record.SetFrom(&value, time.UTC); err != nil {
+			t.Fatalf("got: %v, expected: %v", err, nil)
+		}
+		if got := record.StagedChanges["date"]; got != "02.01.2006" {
+			t.Errorf("got: %v, expected: %v", got, "02.01.2006")
+		}
+		if got := record.StagedChanges["timestamp"]; got != "02.01.2006 15:04:05" {
+			t.Errorf("got: %v, expected: %v", got, "02.01.2006 15:04:05")
+		}
+	})
+}
+
+// TestNewFileLocaleLayouts tests that the file locale date format requires layouts
+func TestNewFileLocaleLayouts(t *testing.T) {
+	server, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	options := []Option{WithHTTPClient(server.Client()), WithDateFormat(DateFormatFileLocale)}
+
+	if _, err := New(server.URL, "database", "username", "password", options...); err == nil {
+		t.Errorf("expected error for missing layouts")
+	}
+
+	options = append(options, WithDateLayouts("02.01.2006", "15:04:05", "02.01.2006 15:04:05"))
+	if _, err := New(server.URL, "database", "username", "password", options...); err != nil {
+		t.Errorf("got: %v, expected: %v", err, nil)
+	}
+}
@@ -1,9 +1,128 @@
 package filemaker
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrNotNumber     = errors.New("value is not a number")
 	ErrNotString     = errors.New("value is not a string")
 	ErrUnknownFormat = errors.New("unknown format")
+	ErrUnknownField  = errors.New("field does not exist in record")
+
+	ErrValueListMissing = errors.New("value list is missing")
+	ErrPortalRow        = errors.New("related records are committed through the record with the portal")
+)
+
+// Sentinel errors for common FileMaker error codes, for use with errors.Is
+var (
+	ErrRecordMissing   = &Error{Code: 101, Message: "Record is missing"}
+	ErrFieldMissing    = &Error{Code: 102, Message: "Field is missing"}
+	ErrLayoutMissing   = &Error{Code: 105, Message: "Layout is missing"}
+	ErrInvalidAccount  = &Error{Code: 212, Message: "Invalid user account and/or password"}
+	ErrRecordLocked    = &Error{Code: 301, Message: "Record is in use by another user"}
+	ErrModIDMismatch   = &Error{Code: 306, Message: "Record modification ID does not match"}
+	ErrNoRecordsMatch  = &Error{Code: 401, Message: "No records match the request"}
+	ErrFieldValidation = &Error{Code: 500, Message: "Field validation failed"}
+	ErrInvalidToken    = &Error{Code: 952, Message: "Invalid FileMaker Data API token"}
 )
+
+/*
+Error is returned when the host responds with a FileMaker error code. It carries the code and
+message reported by the host, the http status code of the response and the method and URL of the
+request that caused it.
+
+Use errors.As to access the details, or errors.Is to compare against the sentinel errors:
+
+	if errors.Is(err, filemaker.ErrRecordLocked) {
+		//Try again later
+	}
+
+Comparing with ErrFieldValidation matches any error in the 500-range, which FileMaker uses for
+field validation failures.
+*/
+type Error struct {
+	Code       int
+	Message    string
+	StatusCode int
+	Method     string
+	URL        string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("failed at host: %v (%v)", e.Message, e.Code)
+}
+
+// Is reports whether the error has the same FileMaker error code as the target
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+
+	if t == ErrFieldValidation {
+		return e.Code >= 500 && e.Code < 600
+	}
+
+	return e.Code == t.Code
+}
+
+// FieldError describes why a struct field could not be mapped from the record field in its tag
+type FieldError struct {
+	Field string
+	Tag   string
+	Err   error
+}
+
+// Error implements the error interface
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%v (fm:%q): %v", e.Field, e.Tag, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// MapError is returned by Record.MapE, listing every struct field that could not be mapped
+type MapError struct {
+	Errors []*FieldError
+}
+
+// Error implements the error interface
+func (e *MapError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("failed to map %d field(s): %v", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Is reports whether the error of any of the fields matches the target, so errors.Is can be
+// used to check for e.g. ErrUnknownField. Implemented here rather than as a multi-error Unwrap,
+// which errors.Is only follows from Go 1.20.
+func (e *MapError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error of the fields that matches the target, so errors.As can be used to
+// get e.g. the *FieldError or *Error of a field
+func (e *MapError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
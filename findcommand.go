@@ -30,6 +30,39 @@ func (c FindCommand) Offset(offset int) FindCommand {
 	return c
 }
 
+//Sort sets the fields the records returned by the findcommand are sorted by, in order of precedence
+func (c FindCommand) Sort(fields ...SortField) FindCommand {
+	c["sort"] = fields
+	return c
+}
+
+//AddSort appends a specified SortField to the sort order of the FindCommand
+func (c *FindCommand) AddSort(field SortField) {
+	if sort, ok := (*c)["sort"]; ok {
+		(*c)["sort"] = append(sort.([]SortField), field)
+	} else {
+		(*c)["sort"] = []SortField{field}
+	}
+}
+
+//Script sets the script to run after the find and sort, with an optional script parameter
+func (c FindCommand) Script(script, param string) FindCommand {
+	setScript(c, "script", script, param)
+	return c
+}
+
+//PrerequestScript sets the script to run before the find, with an optional script parameter
+func (c FindCommand) PrerequestScript(script, param string) FindCommand {
+	setScript(c, "script.prerequest", script, param)
+	return c
+}
+
+//PresortScript sets the script to run after the find but before the sort, with an optional script parameter
+func (c FindCommand) PresortScript(script, param string) FindCommand {
+	setScript(c, "script.presort", script, param)
+	return c
+}
+
 //AddRequest appends a specified FindRequest to the FindCommand
 func (c *FindCommand) AddRequest(request FindRequest) {
 	if query, ok := (*c)["query"]; ok {
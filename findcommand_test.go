@@ -0,0 +1,23 @@
+package filemaker
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestFindCommandSort tests the json encoding of the sort order of a findcommand
+func TestFindCommandSort(t *testing.T) {
+	command := NewFindCommand().Sort(NewSortField("Lastname", SortAscend))
+	command.AddSort(NewSortField("Status", "StatusValueList"))
+
+	b, err := json.Marshal(command["sort"])
+	if err != nil {
+		t.Fatalf("failed to marshal sort: %v", err)
+	}
+
+	got := string(b)
+	expect := `[{"fieldName":"Lastname","sortOrder":"ascend"},{"fieldName":"Status","sortOrder":"StatusValueList"}]`
+	if got != expect {
+		t.Errorf("got: '%v', expected: '%v'", got, expect)
+	}
+}
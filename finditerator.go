@@ -0,0 +1,181 @@
+package filemaker
+
+import "context"
+
+// defaultPageSize is the number of records requested per page when no page size is specified
+const defaultPageSize = 100
+
+/*
+FindIterator pages through every record matching a findcommand, requesting one page of records
+at a time from the host until the whole found set has been returned.
+
+	it := fm.FindIter("layout name", command, 500)
+	for it.Next() {
+		record := it.Record()
+		//...
+	}
+	if err := it.Err(); err != nil {
+		//...
+	}
+
+The found set can change between requests, so sort the findcommand to get a deterministic order.
+*/
+type FindIterator struct {
+	ctx       context.Context
+	session   *Session
+	layout    string
+	command   FindCommand
+	pageSize  int
+	offset    int
+	remaining int
+	info      DataInfo
+	page      []Record
+	index     int
+	record    Record
+	done      bool
+	err       error
+}
+
+// FindIter returns an iterator over all records matching the findcommand, requesting the specified
+// number of records per page. An offset set on the findcommand sets the first record returned and a
+// limit sets the maximum number of records returned in total.
+func (s *Session) FindIter(layout string, command FindCommand, pageSize int) *FindIterator {
+	return s.FindIterContext(context.Background(), layout, command, pageSize)
+}
+
+// FindIterContext behaves like FindIter but sends the requests using the specified context,
+// stopping the iteration with the context error when the context is cancelled
+func (s *Session) FindIterContext(ctx context.Context, layout string, command FindCommand, pageSize int) *FindIterator {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	it := &FindIterator{
+		ctx:       ctx,
+		session:   s,
+		layout:    layout,
+		command:   FindCommand{},
+		pageSize:  pageSize,
+		offset:    1,
+		remaining: -1,
+	}
+
+	//Copy the findcommand so the offset and limit of the caller's findcommand are left untouched
+	for key, value := range command {
+		it.command[key] = value
+	}
+	if offset, ok := command["offset"].(int); ok && offset > 0 {
+		it.offset = offset
+	}
+	if limit, ok := command["limit"].(int); ok && limit >= 0 {
+		it.remaining = limit
+	}
+
+	return it
+}
+
+// Next advances the iterator to the next record, requesting the next page from the host if needed.
+// Returns false when there are no more records or an error occurred.
+func (it *FindIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	if it.index >= len(it.page) && !it.fetch() {
+		return false
+	}
+
+	it.record = it.page[it.index]
+	it.index++
+
+	return true
+}
+
+// fetch requests the next page of records from the host
+func (it *FindIterator) fetch() bool {
+	//Stop when the whole found set or the limit has been returned
+	if it.page != nil && it.offset > it.info.FoundCount {
+		it.done = true
+		return false
+	}
+
+	limit := it.pageSize
+	if it.remaining >= 0 && it.remaining < limit {
+		limit = it.remaining
+	}
+	if limit == 0 {
+		it.done = true
+		return false
+	}
+
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+
+	result, err := it.session.FindWithInfoContext(
+		it.ctx,
+		it.layout,
+		it.command.Offset(it.offset).Limit(limit),
+	)
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.info = result.DataInfo
+	it.page = result.Records
+	it.index = 0
+	it.offset += len(it.page)
+	if it.remaining >= 0 {
+		it.remaining -= len(it.page)
+	}
+
+	if len(it.page) == 0 {
+		it.done = true
+		return false
+	}
+
+	return true
+}
+
+// Record returns the current record of the iterator
+func (it *FindIterator) Record() Record {
+	return it.record
+}
+
+// DataInfo returns the information about the found set, as of the last page requested
+func (it *FindIterator) DataInfo() DataInfo {
+	return it.info
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *FindIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration early, any subsequent calls to Next return false
+func (it *FindIterator) Close() {
+	it.done = true
+}
+
+// FindAll returns all records matching the findcommand, requesting the specified number of records per page
+func (s *Session) FindAll(layout string, command FindCommand, pageSize int) ([]Record, error) {
+	return s.FindAllContext(context.Background(), layout, command, pageSize)
+}
+
+// FindAllContext behaves like FindAll but sends the requests using the specified context
+func (s *Session) FindAllContext(ctx context.Context, layout string, command FindCommand, pageSize int) ([]Record, error) {
+	records := []Record{}
+
+	it := s.FindIterContext(ctx, layout, command, pageSize)
+	for it.Next() {
+		records = append(records, it.Record())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
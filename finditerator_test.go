@@ -0,0 +1,77 @@
+package filemaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestFindIterator tests paging through a found set larger than the page size
+func TestFindIterator(t *testing.T) {
+	const foundCount = 5
+	var pages []string
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var command struct {
+			Offset int `json:"offset"`
+			Limit  int `json:"limit"`
+		}
+		json.NewDecoder(r.Body).Decode(&command)
+		pages = append(pages, fmt.Sprintf("%d+%d", command.Offset, command.Limit))
+
+		var data []string
+		for id := command.Offset; id < command.Offset+command.Limit && id <= foundCount; id++ {
+			data = append(data, fmt.Sprintf(`{"recordId":"%d","modId":"0","fieldData":{}}`, id))
+		}
+		fmt.Fprintf(
+			w,
+			`{"messages":[{"code":"0","message":"OK"}],"response":{"dataInfo":{"foundCount":%d,"returnedCount":%d},"data":[%s]}}`,
+			foundCount,
+			len(data),
+			strings.Join(data, ","),
+		)
+	})
+
+	t.Run("all", func(t *testing.T) {
+		pages = nil
+		records, err := session.FindAll("layout", NewFindCommand(), 2)
+		if err != nil {
+			t.Fatalf("failed to find all records: %v", err)
+		}
+
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+		if got, expect := strings.Join(ids, ","), "1,2,3,4,5"; got != expect {
+			t.Errorf("got: '%v', expected: '%v'", got, expect)
+		}
+		if got, expect := strings.Join(pages, ","), "1+2,3+2,5+2"; got != expect {
+			t.Errorf("got: '%v', expected: '%v'", got, expect)
+		}
+	})
+
+	t.Run("offset_limit", func(t *testing.T) {
+		pages = nil
+		records, err := session.FindAll("layout", NewFindCommand().Offset(2).Limit(3), 2)
+		if err != nil {
+			t.Fatalf("failed to find all records: %v", err)
+		}
+		if len(records) != 3 {
+			t.Errorf("got: %v records, expected: %v", len(records), 3)
+		}
+		if got, expect := strings.Join(pages, ","), "2+2,4+1"; got != expect {
+			t.Errorf("got: '%v', expected: '%v'", got, expect)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		it := session.FindIter("layout", NewFindCommand(), 2)
+		it.Next()
+		it.Close()
+		if it.Next() {
+			t.Errorf("expected no more records after close")
+		}
+	})
+}
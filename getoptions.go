@@ -0,0 +1,110 @@
+package filemaker
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+// GetOptions represents the optional query parameters of requests that get records
+type GetOptions map[string]interface{}
+
+// NewGetOptions returns new empty getoptions
+func NewGetOptions() GetOptions {
+	return GetOptions{}
+}
+
+// Limit sets the limit for the number of records returned
+func (o GetOptions) Limit(limit int) GetOptions {
+	o["_limit"] = limit
+	return o
+}
+
+// Offset sets the offset for the records returned
+func (o GetOptions) Offset(offset int) GetOptions {
+	o["_offset"] = offset
+	return o
+}
+
+// Sort sets the fields the records are sorted by, in order of precedence
+func (o GetOptions) Sort(fields ...SortField) GetOptions {
+	o["_sort"] = fields
+	return o
+}
+
+// Portals sets the portals to include in the response. All portals on the layout are included by default.
+func (o GetOptions) Portals(portals ...string) GetOptions {
+	o["portal"] = portals
+	return o
+}
+
+// PortalLimit sets the limit for the number of related records returned in the specified portal
+func (o GetOptions) PortalLimit(portal string, limit int) GetOptions {
+	o["_limit."+portal] = limit
+	return o
+}
+
+// PortalOffset sets the offset for the related records returned in the specified portal
+func (o GetOptions) PortalOffset(portal string, offset int) GetOptions {
+	o["_offset."+portal] = offset
+	return o
+}
+
+// LayoutResponse sets the layout the record data is returned from, instead of the layout of the request
+func (o GetOptions) LayoutResponse(layout string) GetOptions {
+	o["layout.response"] = layout
+	return o
+}
+
+// Script sets the script to run after the records have been retrieved, with an optional script parameter
+func (o GetOptions) Script(script, param string) GetOptions {
+	setScript(o, "script", script, param)
+	return o
+}
+
+// PrerequestScript sets the script to run before the records are retrieved, with an optional script parameter
+func (o GetOptions) PrerequestScript(script, param string) GetOptions {
+	setScript(o, "script.prerequest", script, param)
+	return o
+}
+
+// PresortScript sets the script to run before the records are sorted, with an optional script parameter
+func (o GetOptions) PresortScript(script, param string) GetOptions {
+	setScript(o, "script.presort", script, param)
+	return o
+}
+
+// withQuery merges the specified getoptions and appends them to the URL as a query string
+func withQuery(url string, options []GetOptions) string {
+	merged := NewGetOptions()
+	for _, opts := range options {
+		for key, value := range opts {
+			merged[key] = value
+		}
+	}
+
+	if len(merged) == 0 {
+		return url
+	}
+
+	return url + "?" + merged.query()
+}
+
+// query encodes the getoptions as a URL query string
+func (o GetOptions) query() string {
+	values := url.Values{}
+
+	for key, value := range o {
+		switch v := value.(type) {
+		case string:
+			values.Set(key, v)
+		case int:
+			values.Set(key, strconv.Itoa(v))
+		default:
+			b, _ := json.Marshal(v)
+			values.Set(key, string(b))
+		}
+	}
+
+	return values.Encode()
+}
@@ -0,0 +1,99 @@
+package filemaker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const (
+	// TagRecordID is the `fm` tag of a string struct field holding the record ID
+	TagRecordID = "@recordId"
+	// TagModID is the `fm` tag of a string struct field holding the modification ID
+	TagModID = "@modId"
+	// TagPortalPrefix prefixes the portal name in the `fm` tag of a slice of structs holding the
+	// related records in the portal, e.g. `fm:"portal:Lines"`
+	TagPortalPrefix = "portal:"
+)
+
+/*
+FindInto performs the specified findcommand on the specified layout and maps each record to a new
+struct of type T using Record.Map, with the record ID and modification ID kept in any struct
+fields tagged `fm:"@recordId"` and `fm:"@modId"`.
+
+	type Hero struct {
+		ID    string `fm:"@recordId"`
+		ModID string `fm:"@modId"`
+		Name  string `fm:"Name"`
+	}
+
+	heroes, err := filemaker.FindInto[Hero](fm, "layout name", command, time.Local)
+*/
+func FindInto[T any](s *Session, layout string, findCommand interface{}, timeLoc *time.Location) ([]T, error) {
+	return FindIntoContext[T](context.Background(), s, layout, findCommand, timeLoc)
+}
+
+// FindIntoContext behaves like FindInto but sends the request using the specified context
+func FindIntoContext[T any](
+	ctx context.Context,
+	s *Session,
+	layout string,
+	findCommand interface{},
+	timeLoc *time.Location,
+) ([]T, error) {
+	if err := checkStruct[T](); err != nil {
+		return nil, err
+	}
+
+	records, err := s.FindContext(ctx, layout, findCommand)
+	if records == nil {
+		return nil, err
+	}
+
+	var objs = make([]T, len(records))
+	for i := range records {
+		records[i].Map(&objs[i], timeLoc)
+	}
+
+	return objs, err
+}
+
+// GetInto gets the record with the specified ID from the specified layout and maps it to a new
+// struct of type T the same way as FindInto
+func GetInto[T any](s *Session, layout, id string, timeLoc *time.Location, options ...GetOptions) (T, error) {
+	return GetIntoContext[T](context.Background(), s, layout, id, timeLoc, options...)
+}
+
+// GetIntoContext behaves like GetInto but sends the request using the specified context
+func GetIntoContext[T any](
+	ctx context.Context,
+	s *Session,
+	layout, id string,
+	timeLoc *time.Location,
+	options ...GetOptions,
+) (T, error) {
+	var obj T
+	if err := checkStruct[T](); err != nil {
+		return obj, err
+	}
+
+	record, err := s.GetRecordContext(ctx, layout, id, options...)
+	if record.ID == "" {
+		return obj, err
+	}
+
+	record.Map(&obj, timeLoc)
+
+	return obj, err
+}
+
+// checkStruct returns an error if T is not a struct type, which is required by Record.Map
+func checkStruct[T any]() error {
+	var obj T
+	if t := reflect.TypeOf(obj); t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot map records to non-struct type %T", obj)
+	}
+
+	return nil
+}
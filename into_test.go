@@ -0,0 +1,52 @@
+package filemaker
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type testHero struct {
+	ID    string `fm:"@recordId"`
+	ModID string `fm:"@modId"`
+	Name  string `fm:"Name"`
+	Age   int    `fm:"Age"`
+}
+
+// TestFindInto tests mapping found records directly to structs
+func TestFindInto(t *testing.T) {
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"data":[
+			{"recordId":"1","modId":"3","fieldData":{"Name":"Mark","Age":44}},
+			{"recordId":"2","modId":"0","fieldData":{"Name":"Anna","Age":31}}
+		]}}`)
+	})
+
+	t.Run("find", func(t *testing.T) {
+		heroes, err := FindInto[testHero](session, "layout", NewFindCommand(), time.UTC)
+		if err != nil {
+			t.Fatalf("failed to find heroes: %v", err)
+		}
+		expect := []testHero{{"1", "3", "Mark", 44}, {"2", "0", "Anna", 31}}
+		if len(heroes) != len(expect) || heroes[0] != expect[0] || heroes[1] != expect[1] {
+			t.Errorf("got: %+v, expected: %+v", heroes, expect)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		hero, err := GetInto[testHero](session, "layout", "1", time.UTC)
+		if err != nil {
+			t.Fatalf("failed to get hero: %v", err)
+		}
+		if hero.ID != "1" || hero.ModID != "3" || hero.Name != "Mark" {
+			t.Errorf("got: %+v", hero)
+		}
+	})
+
+	t.Run("non_struct", func(t *testing.T) {
+		if _, err := FindInto[string](session, "layout", NewFindCommand(), time.UTC); err == nil {
+			t.Errorf("expected error for non-struct type")
+		}
+	})
+}
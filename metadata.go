@@ -0,0 +1,286 @@
+package filemaker
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// LayoutMetadata represents the fields, portals and value lists of a layout
+type LayoutMetadata struct {
+	Fields     []FieldMetadata            `json:"fieldMetaData"`
+	Portals    map[string][]FieldMetadata `json:"portalMetaData"`
+	ValueLists []ValueList                `json:"valueLists"`
+}
+
+/*
+FieldMetadata represents the definition of a field on a layout.
+
+The type is either "normal", "calculation" or "summary" and the result is the data type of the
+field, e.g. "text", "number", "date", "time", "timeStamp" or "container".
+*/
+type FieldMetadata struct {
+	Name            string `json:"name"`
+	Type            string `json:"type"`
+	DisplayType     string `json:"displayType"`
+	Result          string `json:"result"`
+	ValueList       string `json:"valueList"`
+	Global          bool   `json:"global"`
+	AutoEnter       bool   `json:"autoEnter"`
+	FourDigitYear   bool   `json:"fourDigitYear"`
+	MaxRepeat       int    `json:"maxRepeat"`
+	MaxCharacters   int    `json:"maxCharacters"`
+	NotEmpty        bool   `json:"notEmpty"`
+	Numeric         bool   `json:"numeric"`
+	TimeOfDay       bool   `json:"timeOfDay"`
+	RepetitionStart int    `json:"repetitionStart"`
+	RepetitionEnd   int    `json:"repetitionEnd"`
+}
+
+// ValueList represents a value list used by a layout, with the type being either "customList"
+// or "byField"
+type ValueList struct {
+	Name   string           `json:"name"`
+	Type   string           `json:"type"`
+	Values []ValueListValue `json:"values"`
+}
+
+// ValueListValue represents a value in a value list, along with the value displayed to users
+type ValueListValue struct {
+	Value        string `json:"value"`
+	DisplayValue string `json:"displayValue"`
+}
+
+// Field returns the metadata of the field with the specified name on the layout
+func (m LayoutMetadata) Field(name string) (FieldMetadata, bool) {
+	for _, field := range m.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+
+	return FieldMetadata{}, false
+}
+
+// LayoutMetadata gets the field definitions, portals and value lists of the specified layout
+func (s *Session) LayoutMetadata(layout string) (LayoutMetadata, error) {
+	return s.LayoutMetadataContext(context.Background(), layout)
+}
+
+// LayoutMetadataContext behaves like LayoutMetadata but sends the request using the specified context
+func (s *Session) LayoutMetadataContext(ctx context.Context, layout string) (LayoutMetadata, error) {
+	if layout == "" {
+		return LayoutMetadata{}, errors.New("No layout specified")
+	}
+
+	jsonRes, err := s.request(
+		ctx,
+		"GET",
+		fmt.Sprintf("%s/layouts/%s", s.baseURL(), url.PathEscape(layout)),
+		nil,
+		jsonHeader(),
+	)
+	if err != nil {
+		return LayoutMetadata{}, err
+	}
+
+	//Cache the value lists of the layout
+	s.mu.Lock()
+	if s.valueLists == nil {
+		s.valueLists = make(map[string][]ValueList)
+	}
+	s.valueLists[layout] = jsonRes.Response.ValueLists
+	s.mu.Unlock()
+
+	return jsonRes.Response.LayoutMetadata, nil
+}
+
+/*
+ValueList gets the value list with the specified name used by the specified layout, returning
+ErrValueListMissing if the layout doesn't use a value list with the name. The value lists of a
+layout are cached by the session when first requested, use ClearValueLists to get them again.
+*/
+func (s *Session) ValueList(layout, name string) (ValueList, error) {
+	return s.ValueListContext(context.Background(), layout, name)
+}
+
+// ValueListContext behaves like ValueList but sends the request using the specified context
+func (s *Session) ValueListContext(ctx context.Context, layout, name string) (ValueList, error) {
+	s.mu.Lock()
+	valueLists, ok := s.valueLists[layout]
+	s.mu.Unlock()
+
+	if !ok {
+		metadata, err := s.LayoutMetadataContext(ctx, layout)
+		if err != nil {
+			return ValueList{}, err
+		}
+		valueLists = metadata.ValueLists
+	}
+
+	for _, valueList := range valueLists {
+		if valueList.Name == name {
+			return valueList, nil
+		}
+	}
+
+	return ValueList{}, ErrValueListMissing
+}
+
+// ClearValueLists discards the value lists cached by the session
+func (s *Session) ClearValueLists() {
+	s.mu.Lock()
+	s.valueLists = nil
+	s.mu.Unlock()
+}
+
+// Contains returns true if the value is one of the values in the value list. Numbers and bools
+// are compared the same way as they are stored by Record.Set.
+func (l ValueList) Contains(value interface{}) bool {
+	_, ok := l.DisplayValue(value)
+	return ok
+}
+
+// DisplayValue returns the value displayed to users for the specified value in the value list
+func (l ValueList) DisplayValue(value interface{}) (string, bool) {
+	s := valueListValue(value)
+	for _, v := range l.Values {
+		if v.Value == s {
+			return v.DisplayValue, true
+		}
+	}
+
+	return "", false
+}
+
+// valueListValue formats the value the way values are listed in value lists, with numbers
+// converted the same way as by Record.Set and formatted without exponents
+func valueListValue(value interface{}) string {
+	//Format float32 values at their own precision, i.e. 0.1 rather than 0.10000000149011612
+	if f, ok := value.(float32); ok {
+		return strconv.FormatFloat(float64(f), 'f', -1, 32)
+	}
+
+	if f, ok := normalizeValue(value).(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// LayoutInfo represents a layout or a folder of layouts in a database
+type LayoutInfo struct {
+	Name              string       `json:"name"`
+	Table             string       `json:"table"`
+	IsFolder          bool         `json:"isFolder"`
+	FolderLayoutNames []LayoutInfo `json:"folderLayoutNames"`
+}
+
+// ScriptInfo represents a script or a folder of scripts in a database
+type ScriptInfo struct {
+	Name              string       `json:"name"`
+	IsFolder          bool         `json:"isFolder"`
+	FolderScriptNames []ScriptInfo `json:"folderScriptNames"`
+}
+
+// DatabaseInfo represents a database hosted on the server
+type DatabaseInfo struct {
+	Name string `json:"name"`
+}
+
+// Product represents the product information of the server, including the date and time formats
+// used by the Data API
+type Product struct {
+	Name            string `json:"name"`
+	BuildDate       string `json:"buildDate"`
+	Version         string `json:"version"`
+	DateFormat      string `json:"dateFormat"`
+	TimeFormat      string `json:"timeFormat"`
+	TimeStampFormat string `json:"timeStampFormat"`
+}
+
+// Layouts gets the layouts in the database, with layouts in folders listed in the folder
+func (s *Session) Layouts() ([]LayoutInfo, error) {
+	return s.LayoutsContext(context.Background())
+}
+
+// LayoutsContext behaves like Layouts but sends the request using the specified context
+func (s *Session) LayoutsContext(ctx context.Context) ([]LayoutInfo, error) {
+	jsonRes, err := s.request(ctx, "GET", fmt.Sprintf("%s/layouts", s.baseURL()), nil, jsonHeader())
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonRes.Response.Layouts, nil
+}
+
+// Scripts gets the scripts in the database, with scripts in folders listed in the folder
+func (s *Session) Scripts() ([]ScriptInfo, error) {
+	return s.ScriptsContext(context.Background())
+}
+
+// ScriptsContext behaves like Scripts but sends the request using the specified context
+func (s *Session) ScriptsContext(ctx context.Context) ([]ScriptInfo, error) {
+	jsonRes, err := s.request(ctx, "GET", fmt.Sprintf("%s/scripts", s.baseURL()), nil, jsonHeader())
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonRes.Response.Scripts, nil
+}
+
+// Databases gets the databases on the host that the specified account has access to
+func Databases(host, username, password string, options ...Option) ([]DatabaseInfo, error) {
+	return DatabasesContext(context.Background(), host, username, password, options...)
+}
+
+// DatabasesContext behaves like Databases but sends the request using the specified context
+func DatabasesContext(ctx context.Context, host, username, password string, options ...Option) ([]DatabaseInfo, error) {
+	if host == "" {
+		return nil, errors.New("No host specified")
+	}
+
+	s := newSession(host, options)
+	jsonRes, err := s.send(
+		ctx,
+		"GET",
+		fmt.Sprintf("%s/fmi/data/v1/databases", s.Host),
+		nil,
+		jsonHeader(),
+		"Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonRes.Response.Databases, nil
+}
+
+// ProductInfo gets the product information of the host, which doesn't require an account
+func ProductInfo(host string, options ...Option) (Product, error) {
+	return ProductInfoContext(context.Background(), host, options...)
+}
+
+// ProductInfoContext behaves like ProductInfo but sends the request using the specified context
+func ProductInfoContext(ctx context.Context, host string, options ...Option) (Product, error) {
+	if host == "" {
+		return Product{}, errors.New("No host specified")
+	}
+
+	s := newSession(host, options)
+	jsonRes, err := s.send(
+		ctx,
+		"GET",
+		fmt.Sprintf("%s/fmi/data/v1/productInfo", s.Host),
+		nil,
+		jsonHeader(),
+		"",
+	)
+	if err != nil {
+		return Product{}, err
+	}
+
+	return jsonRes.Response.ProductInfo, nil
+}
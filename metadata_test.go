@@ -0,0 +1,171 @@
+package filemaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSessionLayoutMetadata tests decoding the metadata of a layout
+func TestSessionLayoutMetadata(t *testing.T) {
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{
+			"fieldMetaData":[
+				{"name":"Name","type":"normal","displayType":"editText","result":"text","global":false,"autoEnter":false,"maxRepeat":1,"maxCharacters":50,"notEmpty":true},
+				{"name":"Total","type":"calculation","displayType":"editText","result":"number","global":false,"autoEnter":false,"maxRepeat":3}
+			],
+			"portalMetaData":{"Lines":[{"name":"Lines::Qty","type":"normal","result":"number"}]},
+			"valueLists":[{"name":"Status","type":"customList","values":[{"value":"1","displayValue":"Open"}]}]
+		}}`)
+	})
+
+	metadata, err := session.LayoutMetadata("layout")
+	if err != nil {
+		t.Fatalf("failed to get layout metadata: %v", err)
+	}
+
+	t.Run("fields", func(t *testing.T) {
+		field, ok := metadata.Field("Name")
+		if !ok || field.Result != "text" || field.MaxCharacters != 50 || !field.NotEmpty {
+			t.Errorf("got: %+v", field)
+		}
+		field, ok = metadata.Field("Total")
+		if !ok || field.Type != "calculation" || field.MaxRepeat != 3 {
+			t.Errorf("got: %+v", field)
+		}
+	})
+
+	t.Run("portals", func(t *testing.T) {
+		got := metadata.Portals["Lines"]
+		if len(got) != 1 || got[0].Name != "Lines::Qty" {
+			t.Errorf("got: %+v", got)
+		}
+	})
+
+	t.Run("value_lists", func(t *testing.T) {
+		got := metadata.ValueLists
+		if len(got) != 1 || got[0].Values[0].DisplayValue != "Open" {
+			t.Errorf("got: %+v", got)
+		}
+	})
+}
+
+// TestListing tests listing the layouts, scripts and databases on the host
+func TestListing(t *testing.T) {
+	server, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/layouts"):
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"layouts":[{"name":"Main","table":"Main"},{"name":"Reports","isFolder":true,"folderLayoutNames":[{"name":"Sales","table":"Sales"}]}]}}`)
+		case strings.HasSuffix(r.URL.Path, "/scripts"):
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"scripts":[{"name":"Utils","isFolder":true,"folderScriptNames":[{"name":"Cleanup","isFolder":false}]}]}}`)
+		case strings.HasSuffix(r.URL.Path, "/databases"):
+			if user, pass, _ := r.BasicAuth(); user != "username" || pass != "password" {
+				fmt.Fprint(w, `{"messages":[{"code":"212","message":"Invalid user account and/or password"}],"response":{}}`)
+				return
+			}
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"databases":[{"name":"database"}]}}`)
+		case strings.HasSuffix(r.URL.Path, "/productInfo"):
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"productInfo":{"name":"FileMaker Data API Engine","version":"19.4.2","dateFormat":"MM/dd/yyyy"}}}`)
+		}
+	})
+
+	t.Run("layouts", func(t *testing.T) {
+		layouts, err := session.Layouts()
+		if err != nil {
+			t.Fatalf("failed to get layouts: %v", err)
+		}
+		if len(layouts) != 2 || !layouts[1].IsFolder || layouts[1].FolderLayoutNames[0].Name != "Sales" {
+			t.Errorf("got: %+v", layouts)
+		}
+	})
+
+	t.Run("scripts", func(t *testing.T) {
+		scripts, err := session.Scripts()
+		if err != nil {
+			t.Fatalf("failed to get scripts: %v", err)
+		}
+		if len(scripts) != 1 || scripts[0].FolderScriptNames[0].Name != "Cleanup" {
+			t.Errorf("got: %+v", scripts)
+		}
+	})
+
+	t.Run("databases", func(t *testing.T) {
+		databases, err := Databases(server.URL, "username", "password", WithHTTPClient(server.Client()))
+		if err != nil {
+			t.Fatalf("failed to get databases: %v", err)
+		}
+		if len(databases) != 1 || databases[0].Name != "database" {
+			t.Errorf("got: %+v", databases)
+		}
+
+		_, err = Databases(server.URL, "username", "wrong", WithHTTPClient(server.Client()))
+		if !errors.Is(err, ErrInvalidAccount) {
+			t.Errorf("got: %v, expected: %v", err, ErrInvalidAccount)
+		}
+	})
+
+	t.Run("product_info", func(t *testing.T) {
+		info, err := ProductInfo(server.URL, WithHTTPClient(server.Client()))
+		if err != nil {
+			t.Fatalf("failed to get product info: %v", err)
+		}
+		if info.Version != "19.4.2" || info.DateFormat != "MM/dd/yyyy" {
+			t.Errorf("got: %+v", info)
+		}
+	})
+}
+
+// TestSessionValueList tests getting and caching the value lists of a layout
+func TestSessionValueList(t *testing.T) {
+	requests := 0
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"valueLists":[{"name":"Status","type":"customList","values":[{"value":"1","displayValue":"Open"},{"value":"2","displayValue":"Closed"}]}]}}`)
+	})
+
+	valueList, err := session.ValueList("layout", "Status")
+	if err != nil {
+		t.Fatalf("failed to get value list: %v", err)
+	}
+
+	t.Run("values", func(t *testing.T) {
+		if got, ok := valueList.DisplayValue(2); !ok || got != "Closed" {
+			t.Errorf("got: '%v', expected: '%v'", got, "Closed")
+		}
+		if valueList.Contains("3") {
+			t.Errorf("expected value list not to contain 3")
+		}
+	})
+
+	t.Run("numbers", func(t *testing.T) {
+		numbers := ValueList{Values: []ValueListValue{
+			{Value: "1234567", DisplayValue: "Customer"},
+			{Value: "0.1", DisplayValue: "Tenth"},
+		}}
+		for _, value := range []interface{}{1234567, int64(1234567), float64(1234567), float32(0.1), 0.1} {
+			if !numbers.Contains(value) {
+				t.Errorf("expected value list to contain %v (%T)", value, value)
+			}
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		_, err := session.ValueList("layout", "Missing")
+		if !errors.Is(err, ErrValueListMissing) {
+			t.Errorf("got: %v, expected: %v", err, ErrValueListMissing)
+		}
+		if requests != 1 {
+			t.Errorf("got: %v requests, expected: %v", requests, 1)
+		}
+	})
+
+	t.Run("cleared", func(t *testing.T) {
+		session.ClearValueLists()
+		session.ValueList("layout", "Status")
+		if requests != 2 {
+			t.Errorf("got: %v requests, expected: %v", requests, 2)
+		}
+	})
+}
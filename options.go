@@ -0,0 +1,42 @@
+package filemaker
+
+import "net/http"
+
+// Option configures a Session when passed to New or NewContext
+type Option func(*Session)
+
+// WithHTTPClient makes the session send all of its requests using the specified http client
+// instead of http.DefaultClient. Useful for configuring timeouts, proxies and connection pools.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Session) {
+		s.client = client
+	}
+}
+
+// WithTransport makes the session send all of its requests using the specified round tripper,
+// e.g. an *http.Transport configured with custom TLS root certificates. It can be combined with
+// WithHTTPClient in any order, the client is copied rather than modified.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(s *Session) {
+		s.transport = transport
+	}
+}
+
+// WithDateFormat makes the session send the `dateformats` parameter with requests for records,
+// so the host formats dates, times and timestamps accordingly. Parsing and formatting field data
+// uses the layouts of the format. DateFormatFileLocale requires all layouts to be specified with
+// WithDateLayouts, otherwise New returns an error.
+func WithDateFormat(format DateFormat) Option {
+	return func(s *Session) {
+		s.dateFormat = format
+	}
+}
+
+// WithDateLayouts specifies the Go time layouts of the date, time and timestamp fields used when
+// parsing and formatting field data, e.g. "02.01.2006" for a file with a European locale.
+// Empty layouts fall back to the layouts of the date format.
+func WithDateLayouts(date, time, timestamp string) Option {
+	return func(s *Session) {
+		s.layouts = dateLayouts{date, time, timestamp}
+	}
+}
@@ -0,0 +1,56 @@
+package filemaker
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// countingTransport counts the requests sent using the wrapped round tripper
+type countingTransport struct {
+	transport http.RoundTripper
+	requests  int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests++
+	return t.transport.RoundTrip(r)
+}
+
+// TestWithTransport tests that the transport is used regardless of the order of the options
+func TestWithTransport(t *testing.T) {
+	server, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{}}`)
+	})
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	orders := map[string]func(*countingTransport) []Option{
+		"transport_first": func(transport *countingTransport) []Option {
+			return []Option{WithTransport(transport), WithHTTPClient(client)}
+		},
+		"client_first": func(transport *countingTransport) []Option {
+			return []Option{WithHTTPClient(client), WithTransport(transport)}
+		},
+	}
+
+	for name, options := range orders {
+		t.Run(name, func(t *testing.T) {
+			transport := &countingTransport{transport: server.Client().Transport}
+			session, err := New(server.URL, "database", "username", "password", options(transport)...)
+			if err != nil {
+				t.Fatalf("failed to start session: %v", err)
+			}
+			if err := session.Destroy(); err != nil {
+				t.Fatalf("failed to destroy session: %v", err)
+			}
+
+			if transport.requests != 2 {
+				t.Errorf("got: %v requests, expected: %v", transport.requests, 2)
+			}
+			if session.httpClient().Timeout != client.Timeout || client.Transport != nil {
+				t.Errorf("expected the timeout of the client to be kept without modifying the client")
+			}
+		})
+	}
+}
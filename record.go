@@ -2,6 +2,8 @@ package filemaker
 
 import (
 	"bytes"
+	"context"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,32 +14,300 @@ import (
 	"net/http"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 //Record interface for some magic with methods
 type Record struct {
-	ID            string
-	Layout        string
-	StagedChanges map[string]interface{}
-	FieldData     map[string]interface{}
-	Session       *Session
+	ID             string
+	ModID          string
+	Layout         string
+	StagedChanges  map[string]interface{}
+	FieldData      map[string]interface{}
+	PortalData     map[string][]Record
+	PortalDataInfo map[string]PortalDataInfo
+	ScriptResults  ScriptResults
+	Session        *Session
+	deleteRelated  []string
+	scripts        map[string]interface{}
+	portal         string
+}
+
+//PortalDataInfo represents the information about the related records returned in a portal
+type PortalDataInfo struct {
+	PortalObjectName string
+	Database         string
+	Table            string
+	FoundCount       int
+	ReturnedCount    int
 }
 
 //newRecord returns a new instance of an existing record
-func newRecord(layout string, data interface{}, session Session) Record {
-	return Record{
-		ID:            data.(map[string]interface{})["recordId"].(string),
+func newRecord(layout string, data interface{}, session *Session) Record {
+	record := Record{
+		Layout:        layout,
+		StagedChanges: make(map[string]interface{}),
+		FieldData:     make(map[string]interface{}),
+		Session:       session,
+	}
+	record.ID, _ = data.(map[string]interface{})["recordId"].(string)
+	record.ModID, _ = data.(map[string]interface{})["modId"].(string)
+	if fieldData, ok := data.(map[string]interface{})["fieldData"].(map[string]interface{}); ok {
+		record.FieldData = fieldData
+	}
+
+	//Parse the related records of each portal
+	if portalData, ok := data.(map[string]interface{})["portalData"].(map[string]interface{}); ok {
+		record.PortalData = make(map[string][]Record)
+		for portal, rows := range portalData {
+			rows, _ := rows.([]interface{})
+			record.PortalData[portal] = make([]Record, 0, len(rows))
+			for _, row := range rows {
+				record.PortalData[portal] = append(record.PortalData[portal], newPortalRow(layout, portal, row, session))
+			}
+		}
+	}
+
+	//Parse the information about the related records of each portal
+	if infos, ok := data.(map[string]interface{})["portalDataInfo"].([]interface{}); ok {
+		record.PortalDataInfo = make(map[string]PortalDataInfo)
+		for _, info := range infos {
+			info, _ := info.(map[string]interface{})
+			portalInfo := PortalDataInfo{}
+			portalInfo.PortalObjectName, _ = info["portalObjectName"].(string)
+			portalInfo.Database, _ = info["database"].(string)
+			portalInfo.Table, _ = info["table"].(string)
+			if foundCount, ok := info["foundCount"].(float64); ok {
+				portalInfo.FoundCount = int(foundCount)
+			}
+			if returnedCount, ok := info["returnedCount"].(float64); ok {
+				portalInfo.ReturnedCount = int(returnedCount)
+			}
+			record.PortalDataInfo[portalInfo.PortalObjectName] = portalInfo
+		}
+	}
+
+	return record
+}
+
+//newPortalRow returns a new instance of a related record in a portal, where the record ID and
+//modification ID are part of the field data. The related record keeps the layout of the record
+//with the portal, so it can't be committed, reloaded or deleted by itself.
+func newPortalRow(layout, portal string, data interface{}, session *Session) Record {
+	record := Record{
 		Layout:        layout,
 		StagedChanges: make(map[string]interface{}),
-		FieldData:     data.(map[string]interface{})["fieldData"].(map[string]interface{}),
-		Session:       &session,
+		FieldData:     make(map[string]interface{}),
+		Session:       session,
+		portal:        portal,
+	}
+
+	fieldData, _ := data.(map[string]interface{})
+	for fieldName, value := range fieldData {
+		switch fieldName {
+		case "recordId":
+			record.ID, _ = value.(string)
+		case "modId":
+			record.ModID, _ = value.(string)
+		default:
+			record.FieldData[fieldName] = value
+		}
 	}
+
+	return record
 }
 
-//Set sets the value of a specified field in the given record
+//Portals returns the names of the portals with related records in the record, sorted by name
+func (r *Record) Portals() []string {
+	var portals []string
+	for portal := range r.PortalData {
+		portals = append(portals, portal)
+	}
+	sort.Strings(portals)
+
+	return portals
+}
+
+/*
+Portal returns the related records in the specified portal. The field data of related records is
+accessed with fully qualified field names, i.e. `row.String("Table::Field")`. Related records are
+changed through the record with the portal using SetPortalRow, AddPortalRow and DeletePortalRow;
+committing, reloading or deleting a related record by itself returns ErrPortalRow.
+*/
+func (r *Record) Portal(portal string) []Record {
+	return r.PortalData[portal]
+}
+
+//SetPortalRow stages a change to the field of the related record with the specified ID in the
+//specified portal, which is committed along with the field data of the record
+func (r *Record) SetPortalRow(portal, recordID, fieldName string, value interface{}) {
+	for i := range r.PortalData[portal] {
+		if r.PortalData[portal][i].ID == recordID {
+			r.PortalData[portal][i].Set(fieldName, value)
+			return
+		}
+	}
+
+	//The related record has not been retrieved, stage the change for it anyway
+	row := newPortalRow(r.Layout, portal, map[string]interface{}{"recordId": recordID}, r.Session)
+	row.Set(fieldName, value)
+	r.addPortalRow(portal, row)
+}
+
+//AddPortalRow stages a new related record with the specified field data in the specified portal,
+//which is created when the record is committed
+func (r *Record) AddPortalRow(portal string, fieldData map[string]interface{}) {
+	row := newPortalRow(r.Layout, portal, nil, r.Session)
+	for fieldName, value := range fieldData {
+		row.Set(fieldName, value)
+	}
+	r.addPortalRow(portal, row)
+}
+
+//addPortalRow appends the related record to the specified portal
+func (r *Record) addPortalRow(portal string, row Record) {
+	if r.PortalData == nil {
+		r.PortalData = make(map[string][]Record)
+	}
+	r.PortalData[portal] = append(r.PortalData[portal], row)
+}
+
+//DeletePortalRow stages the deletion of the related record with the specified ID in the specified
+//portal, which is deleted when the record is committed
+func (r *Record) DeletePortalRow(portal, recordID string) {
+	//Related records are deleted by table occurrence name, which may differ from the portal name
+	table := portal
+	if info, ok := r.PortalDataInfo[portal]; ok && info.Table != "" {
+		table = info.Table
+	}
+
+	r.deleteRelated = append(r.deleteRelated, table+"."+recordID)
+}
+
+//hasPortalChanges returns true if there are any staged changes to the related records of the record
+func (r *Record) hasPortalChanges() bool {
+	if len(r.deleteRelated) > 0 {
+		return true
+	}
+
+	for _, rows := range r.PortalData {
+		for _, row := range rows {
+			if len(row.StagedChanges) > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//requestBody builds the json body of the requests creating and editing the record, containing
+//the staged field data and any staged changes to related records. The modification IDs are
+//included if they should be checked by the host.
+func (r *Record) requestBody(checkModID bool) ([]byte, error) {
+	var fieldData = make(map[string]interface{})
+	for fieldName, value := range r.StagedChanges {
+		fieldData[fieldName] = value
+	}
+
+	if len(r.deleteRelated) == 1 {
+		fieldData["deleteRelated"] = r.deleteRelated[0]
+	} else if len(r.deleteRelated) > 1 {
+		fieldData["deleteRelated"] = r.deleteRelated
+	}
+
+	var jsonData = map[string]interface{}{
+		"fieldData": fieldData,
+	}
+	for key, value := range r.scripts {
+		jsonData[key] = value
+	}
+	if checkModID && r.ModID != "" {
+		jsonData["modId"] = r.ModID
+	}
+	if r.Session.hasDateFormat() {
+		jsonData["dateformats"] = int(r.Session.dateFormat)
+	}
+
+	//Add the related records with staged changes, new related records lack a record ID
+	var portalData = make(map[string][]map[string]interface{})
+	for portal, rows := range r.PortalData {
+		for _, row := range rows {
+			if len(row.StagedChanges) == 0 {
+				continue
+			}
+
+			var rowData = make(map[string]interface{})
+			for fieldName, value := range row.StagedChanges {
+				rowData[fieldName] = value
+			}
+			if row.ID != "" {
+				rowData["recordId"] = row.ID
+			}
+			if checkModID && row.ID != "" && row.ModID != "" {
+				rowData["modId"] = row.ModID
+			}
+
+			portalData[portal] = append(portalData[portal], rowData)
+		}
+	}
+	if len(portalData) > 0 {
+		jsonData["portalData"] = portalData
+	}
+
+	return json.Marshal(jsonData)
+}
+
+//SetScript sets the script to run after the record is next committed or deleted, with an optional script parameter.
+//The results of the script are stored in ScriptResults and a *ScriptError is returned if it fails.
+//Scripts are not run when committing a record without any staged changes.
+func (r *Record) SetScript(script, param string) {
+	r.setScript("script", script, param)
+}
+
+//SetPrerequestScript sets the script to run before the record is next committed or deleted, with an optional script parameter
+func (r *Record) SetPrerequestScript(script, param string) {
+	r.setScript("script.prerequest", script, param)
+}
+
+//setScript stages the script to run in the specified phase of the next request
+func (r *Record) setScript(phase, script, param string) {
+	if r.scripts == nil {
+		r.scripts = make(map[string]interface{})
+	}
+	setScript(r.scripts, phase, script, param)
+}
+
+//scriptsRun stores the results of the scripts run as part of a request and discards the staged
+//scripts, returning a *ScriptError if any of them failed
+func (r *Record) scriptsRun(jsonRes ResponseBody) error {
+	r.ScriptResults = newScriptResults(jsonRes)
+	r.scripts = nil
+	return r.ScriptResults.Err()
+}
+
+//Set sets the value of a specified field in the given record. Numbers and bools are converted to
+//FileMaker numbers and time.Time values are formatted as timestamps using the layouts of the session,
+//use SetDate and SetTime for date and time fields.
 func (r *Record) Set(fieldName string, value interface{}) {
+	r.StagedChanges[fieldName] = formatValue(value, r.Session.timeLayouts())
+}
+
+//SetDate sets the value of a specified date field, formatted using the date layout of the session
+func (r *Record) SetDate(fieldName string, value time.Time) {
+	r.StagedChanges[fieldName] = formatTime(value, r.Session.timeLayouts().date)
+}
+
+//SetTime sets the value of a specified time field, formatted using the time layout of the session
+func (r *Record) SetTime(fieldName string, value time.Time) {
+	r.StagedChanges[fieldName] = formatTime(value, r.Session.timeLayouts().time)
+}
+
+//normalizeValue converts numbers and bools to the float64 representation of FileMaker number fields
+func normalizeValue(value interface{}) interface{} {
 	switch value.(type) {
 	case int:
 		value = float64(value.(int))
@@ -59,7 +329,7 @@ func (r *Record) Set(fieldName string, value interface{}) {
 		}
 	}
 
-	r.StagedChanges[fieldName] = value
+	return value
 }
 
 //Get gets the value of a field in the given record and returns it as an `interface{}`
@@ -71,76 +341,166 @@ func (r *Record) Get(fieldName string) interface{} {
 	return r.FieldData[fieldName]
 }
 
-//Reset discards all uncommited changes made to the record
+//Reset discards all uncommited changes made to the record, including changes to related records
 func (r *Record) Reset() {
 	r.StagedChanges = make(map[string]interface{})
+	r.deleteRelated = nil
+	r.scripts = nil
+
+	for portal, rows := range r.PortalData {
+		var kept []Record
+		for _, row := range rows {
+			//Discard new related records
+			if row.ID == "" {
+				continue
+			}
+			row.Reset()
+			kept = append(kept, row)
+		}
+		r.PortalData[portal] = kept
+	}
 }
 
 //Commit commits the changes made to the record using the same session the record was retrieved/created with
 func (r *Record) Commit() error {
-	if len(r.StagedChanges) == 0 {
-		return nil
+	return r.CommitContext(context.Background())
+}
+
+//CommitContext behaves like Commit but sends the request(s) using the specified context
+func (r *Record) CommitContext(ctx context.Context) error {
+	return r.commit(ctx, false)
+}
+
+/*
+CommitChecked behaves like Commit but only commits the changes if the record has not been modified
+since it was retrieved, by sending the modification ID of the record and its related records.
+An error matching ErrModIDMismatch is returned if the record has been modified, in which case
+Reload can be used to get the current data of the record before committing again.
+*/
+func (r *Record) CommitChecked() error {
+	return r.CommitCheckedContext(context.Background())
+}
+
+//CommitCheckedContext behaves like CommitChecked but sends the request(s) using the specified context
+func (r *Record) CommitCheckedContext(ctx context.Context) error {
+	return r.commit(ctx, true)
+}
+
+//commit commits the changes made to the record, optionally checking the modification IDs
+func (r *Record) commit(ctx context.Context, checkModID bool) error {
+	if r.portal != "" {
+		return ErrPortalRow
 	}
 
-	if r.ID == "" {
-		return r.Create()
+	if len(r.StagedChanges) == 0 && !r.hasPortalChanges() {
+		return nil
 	}
 
-	var jsonData = struct {
-		FieldData map[string]interface{} `json:"fieldData"`
-	}{
-		r.StagedChanges,
+	if r.ID == "" {
+		return r.CreateContext(ctx)
 	}
 
 	//Create the request json body
-	var requestBody, err = json.Marshal(jsonData)
+	var requestBody, err = r.requestBody(checkModID)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request body: %v", err.Error())
 	}
 
-	//Build and send request to the host
-	req, err := http.NewRequest(
+	//Send request to the host
+	jsonRes, err := r.Session.request(
+		ctx,
 		"PATCH",
 		r.Session.recordsURL(r.Layout, r.ID),
-		bytes.NewBuffer(requestBody),
+		requestBody,
+		jsonHeader(),
 	)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+r.Session.Token)
-	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send PATCH request: %v", err.Error())
+		return err
 	}
 
-	//Read the body
-	resBodyBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err.Error())
+	for fieldName, value := range r.StagedChanges {
+		r.FieldData[fieldName] = value
 	}
+	r.ModID = jsonRes.Response.ModID
+	scriptErr := r.scriptsRun(jsonRes)
+
+	//Get the related records from the host, new related records have been assigned IDs
+	if r.hasPortalChanges() {
+		updated, err := r.Session.GetRecordContext(ctx, r.Layout, r.ID)
+		if err != nil {
+			return err
+		}
 
-	//Unmarshal json body
-	var jsonRes ResponseBody
-	err = json.Unmarshal(resBodyBytes, &jsonRes)
-	if err != nil {
-		return fmt.Errorf("failed to decode response body as json: %v", err.Error())
+		r.PortalData = updated.PortalData
+		r.PortalDataInfo = updated.PortalDataInfo
+		r.deleteRelated = nil
 	}
 
-	if jsonRes.Messages[0].Code != "0" {
-		return fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
+	return scriptErr
+}
+
+//Reload gets the current data of the record from the host while keeping any staged changes,
+//including changes to related records, so they can be committed again
+func (r *Record) Reload() error {
+	return r.ReloadContext(context.Background())
+}
+
+//ReloadContext behaves like Reload but sends the request using the specified context
+func (r *Record) ReloadContext(ctx context.Context) error {
+	if r.portal != "" {
+		return ErrPortalRow
 	}
 
-	for fieldName, value := range r.StagedChanges {
-		r.FieldData[fieldName] = value
+	if r.ID == "" {
+		return errors.New("record needs to be created first")
 	}
 
+	current, err := r.Session.GetRecordContext(ctx, r.Layout, r.ID)
+	if err != nil {
+		return err
+	}
+
+	//Reapply the staged changes to the current related records
+	for portal, rows := range r.PortalData {
+		for _, row := range rows {
+			if len(row.StagedChanges) == 0 {
+				continue
+			}
+
+			found := false
+			for i := range current.PortalData[portal] {
+				if row.ID != "" && current.PortalData[portal][i].ID == row.ID {
+					current.PortalData[portal][i].StagedChanges = row.StagedChanges
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				current.addPortalRow(portal, row)
+			}
+		}
+	}
+
+	r.ModID = current.ModID
+	r.FieldData = current.FieldData
+	r.PortalData = current.PortalData
+	r.PortalDataInfo = current.PortalDataInfo
+
 	return nil
 }
 
 //CommitToContainer commits the specified bytes buffer to the specified container field in the record.
 func (r *Record) CommitToContainer(fieldName, filename string, dataBuf bytes.Buffer) error {
+	return r.CommitToContainerContext(context.Background(), fieldName, filename, dataBuf)
+}
+
+//CommitToContainerContext behaves like CommitToContainer but sends the request(s) using the specified context
+func (r *Record) CommitToContainerContext(ctx context.Context, fieldName, filename string, dataBuf bytes.Buffer) error {
+	if r.portal != "" {
+		return ErrPortalRow
+	}
+
 	if r.ID == "" {
 		return errors.New("Record needs to be created first")
 	}
@@ -161,50 +521,38 @@ func (r *Record) CommitToContainer(fieldName, filename string, dataBuf bytes.Buf
 		return err
 	}
 
-	//Build and send request to the host
-	req, err := http.NewRequest(
+	//Send request to the host
+	_, err = r.Session.request(
+		ctx,
 		"POST",
 		fmt.Sprintf(
 			"%s/containers/%s",
 			r.Session.recordsURL(r.Layout, r.ID),
 			fieldName,
 		),
-		body,
+		body.Bytes(),
+		http.Header{
+			"Content-Disposition": []string{
+				mime.FormatMediaType("attachment", map[string]string{"filename": filename}),
+			},
+			"Content-Type": []string{writer.FormDataContentType()},
+		},
 	)
-	cd := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
-	req.Header.Set("Content-Disposition", cd)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Add("Authorization", "Bearer "+r.Session.Token)
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send POST request: %v", err.Error())
-	}
-
-	//Read the body
-	resBodyBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err.Error())
-	}
-
-	// //Unmarshal json body
-	jsonRes := &ResponseBody{}
-	if err := json.Unmarshal(resBodyBytes, &jsonRes); err != nil {
-		return fmt.Errorf("failed to decode response body as json: %v", err.Error())
-	}
 
-	if jsonRes.Messages[0].Code != "0" {
-		return fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
-	}
-
-	return nil
+	return err
 }
 
 //CommitFileToContainer commits the specified file to specified container field in the record
 func (r *Record) CommitFileToContainer(fieldName, filepath string) error {
+	return r.CommitFileToContainerContext(context.Background(), fieldName, filepath)
+}
+
+//CommitFileToContainerContext behaves like CommitFileToContainer but sends the request(s) using the specified context
+func (r *Record) CommitFileToContainerContext(ctx context.Context, fieldName, filepath string) error {
+	if r.portal != "" {
+		return ErrPortalRow
+	}
+
 	//Record is empty and not created yet
 	if r.ID == "" {
 		return errors.New("record needs to be created first")
@@ -219,56 +567,36 @@ func (r *Record) CommitFileToContainer(fieldName, filepath string) error {
 	pathSlice := strings.Split(filepath, "/")
 	filename := pathSlice[len(pathSlice)-1]
 
-	return r.CommitToContainer(fieldName, filename, *buf)
+	return r.CommitToContainerContext(ctx, fieldName, filename, *buf)
 }
 
 //Create inserts the record into the database if it doesn't exist
 func (r *Record) Create() error {
-	var jsonData = struct {
-		FieldData map[string]interface{} `json:"fieldData"`
-	}{
-		r.StagedChanges,
+	return r.CreateContext(context.Background())
+}
+
+//CreateContext behaves like Create but sends the request(s) using the specified context
+func (r *Record) CreateContext(ctx context.Context) error {
+	if r.portal != "" {
+		return ErrPortalRow
 	}
 
 	//Create the request json body
-	var requestBody, err = json.Marshal(jsonData)
+	var requestBody, err = r.requestBody(false)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request body: %v", err.Error())
 	}
 
-	//Build and send request to the host to create record
-	req, err := http.NewRequest(
+	//Send request to the host to create record
+	jsonRes, err := r.Session.request(
+		ctx,
 		"POST",
 		r.Session.recordsURL(r.Layout, ""),
-		bytes.NewBuffer(requestBody),
+		requestBody,
+		jsonHeader(),
 	)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+r.Session.Token)
-	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send POST request: %v", err.Error())
-	}
-
-	//Read the body
-	resBodyBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err.Error())
-	}
-
-	//Unmarshal json body
-	var jsonRes ResponseBody
-	err = json.Unmarshal(resBodyBytes, &jsonRes)
-	if err != nil {
-		return fmt.Errorf("failed to decode response body as json: %v", err.Error())
-	}
-
-	//Check for errors in the response
-	if jsonRes.Messages[0].Code != "0" {
-		return fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
+		return err
 	}
 
 	//Update local record field data with staged changes
@@ -276,93 +604,63 @@ func (r *Record) Create() error {
 		r.FieldData[fieldName] = value
 	}
 
-	//Set the ID returned by the API
+	//Set the IDs returned by the API
 	r.ID = jsonRes.Response.RecordID
+	r.ModID = jsonRes.Response.ModID
+	scriptErr := r.scriptsRun(jsonRes)
 
-	//Build and send request to the host to get the default field data for the created record
-	req, err = http.NewRequest(
-		"GET",
-		r.Session.recordsURL(r.Layout, r.ID),
-		bytes.NewBuffer([]byte{}),
-	)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+r.Session.Token)
-	res, err = http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send GET request: %v", err.Error())
-	}
-
-	//Read the body
-	resBodyBytes, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err.Error())
-	}
-
-	//Unmarshal json body
-	err = json.Unmarshal(resBodyBytes, &jsonRes)
+	//Get the default field data for the created record
+	created, err := r.Session.GetRecordContext(ctx, r.Layout, r.ID)
 	if err != nil {
-		return fmt.Errorf("failed to decode response body as json: %v", err.Error())
-	}
-
-	//Check for errors in the response
-	if jsonRes.Messages[0].Code != "0" {
-		return fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
+		return err
 	}
 
 	//Parse the field data for the record
-	for fieldname, val := range jsonRes.Response.Data[0].(map[string]interface{})["fieldData"].(map[string]interface{}) {
+	for fieldname, val := range created.FieldData {
 		r.FieldData[fieldname] = val
 	}
+	r.ModID = created.ModID
+	r.PortalData = created.PortalData
+	r.PortalDataInfo = created.PortalDataInfo
+	r.deleteRelated = nil
 
-	return nil
+	return scriptErr
 }
 
 //Delete deletes the record using the same session the record was retrieved with
 func (r *Record) Delete() error {
-	//Build and send request to the host
-	req, err := http.NewRequest(
-		"DELETE",
-		r.Session.recordsURL(r.Layout, r.ID),
-		bytes.NewBuffer([]byte{}),
-	)
-	req.Header.Add("Authorization", "Bearer "+r.Session.Token)
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send DELETE request: %v", err.Error())
-	}
+	return r.DeleteContext(context.Background())
+}
 
-	//Read the body
-	resBodyBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err.Error())
+//DeleteContext behaves like Delete but sends the request(s) using the specified context
+func (r *Record) DeleteContext(ctx context.Context) error {
+	if r.portal != "" {
+		return ErrPortalRow
 	}
 
-	//Unmarshal json body
-	var jsonRes ResponseBody
-	err = json.Unmarshal(resBodyBytes, &jsonRes)
+	//Send request to the host, with any scripts as query parameters
+	jsonRes, err := r.Session.request(
+		ctx,
+		"DELETE",
+		withQuery(r.Session.recordsURL(r.Layout, r.ID), []GetOptions{r.scripts}),
+		nil,
+		nil,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to decode response body as json: %v", err.Error())
-	}
-
-	//Check response code
-	if jsonRes.Messages[0].Code != "0" {
-		return fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
+		return err
 	}
+	scriptErr := r.scriptsRun(jsonRes)
 
 	//Empty the local record instance
 	r.ID = ""
+	r.ModID = ""
 	r.StagedChanges = map[string]interface{}{}
 	r.FieldData = map[string]interface{}{}
+	r.PortalData = nil
+	r.PortalDataInfo = nil
+	r.deleteRelated = nil
 
-	return nil
+	return scriptErr
 }
 
 //StringE behaves like String but returns ErrNotString if the value is not a string.
@@ -545,13 +843,24 @@ func (r *Record) Bool(fieldName string) bool {
 
 /*
 TimeE gets the data in the specified field and attempts to parse it as a `time.Time` object
-and returns any errors that occur.
+and returns any errors that occur. The layouts configured with WithDateLayouts or WithDateFormat
+are tried before the default formats. Time fields are parsed as times on January 1, year 0.
 */
 func (r Record) TimeE(fieldName string, loc *time.Location) (time.Time, error) {
-	data := r.String(fieldName)
+	return parseTime(r.String(fieldName), loc, r.Session.timeLayouts())
+}
+
+//parseTime attempts to parse the data of a date, time or timestamp field as a `time.Time` object,
+//trying the layouts of the session before the default formats. Fractional seconds are accepted.
+func parseTime(data string, loc *time.Location, layouts dateLayouts) (time.Time, error) {
+	for _, layout := range []string{layouts.timestamp, layouts.date, layouts.time} {
+		if t, err := time.ParseInLocation(layout, data, loc); err == nil {
+			return t, nil
+		}
+	}
 
 	//Attempt to parse as timestamp in format MM/dd/yyyy HH:mm:ss
-	if match, err := regexp.MatchString(`^\d{2}\/\d{2}\/\d{4} \d{2}:\d{2}:\d{2}$`, data); err != nil {
+	if match, err := regexp.MatchString(`^\d{2}\/\d{2}\/\d{4} \d{2}:\d{2}:\d{2}(\.\d+)?$`, data); err != nil {
 		return time.Time{}, err
 	} else if match {
 		return time.ParseInLocation("01/02/2006 15:04:05", data, loc)
@@ -565,7 +874,7 @@ func (r Record) TimeE(fieldName string, loc *time.Location) (time.Time, error) {
 	}
 
 	//Attempt to parse as timestamp in format yyyy-MM-dd HH:mm:ss
-	if match, err := regexp.MatchString(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`, data); err != nil {
+	if match, err := regexp.MatchString(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?$`, data); err != nil {
 		return time.Time{}, err
 	} else if match {
 		return time.ParseInLocation("2006-01-02 15:04:05", data, loc)
@@ -578,6 +887,13 @@ func (r Record) TimeE(fieldName string, loc *time.Location) (time.Time, error) {
 		return time.ParseInLocation("2006-01-02", data, loc)
 	}
 
+	//Attempt to parse as time in format HH:mm:ss
+	if match, err := regexp.MatchString(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`, data); err != nil {
+		return time.Time{}, err
+	} else if match {
+		return time.ParseInLocation("15:04:05", data, loc)
+	}
+
 	return time.Time{}, ErrUnknownFormat
 }
 
@@ -587,6 +903,117 @@ func (r *Record) Time(fieldName string, loc *time.Location) time.Time {
 	return t
 }
 
+//repFieldName returns the name of the specified repetition of a field, where the first repetition
+//is the field itself
+func repFieldName(fieldName string, repetition int) string {
+	if repetition <= 1 {
+		return fieldName
+	}
+	return fmt.Sprintf("%s(%d)", fieldName, repetition)
+}
+
+//Repetitions returns the number of repetitions of the specified field returned by the host, which
+//depends on the number of repetitions shown on the layout
+func (r *Record) Repetitions(fieldName string) int {
+	n := 0
+	for r.hasField(repFieldName(fieldName, n+1)) || (n == 0 && r.hasField(fieldName+"(1)")) {
+		n++
+	}
+	return n
+}
+
+/*
+GetRep gets the value of the specified repetition of a field, starting at 1, and returns it as an
+`interface{}`. Repetitions are addressed as `Field(n)` in the Data API, with the first repetition
+being `Field` itself.
+*/
+func (r *Record) GetRep(fieldName string, repetition int) interface{} {
+	name := repFieldName(fieldName, repetition)
+	if !r.hasField(name) && repetition == 1 {
+		name = fieldName + "(1)"
+	}
+	return r.Get(name)
+}
+
+//SetRep sets the value of the specified repetition of a field, starting at 1
+func (r *Record) SetRep(fieldName string, repetition int, value interface{}) {
+	r.Set(repFieldName(fieldName, repetition), value)
+}
+
+//StringRepE behaves like StringE but gets the specified repetition of the field
+func (r *Record) StringRepE(fieldName string, repetition int) (string, error) {
+	if val, ok := r.GetRep(fieldName, repetition).(string); ok {
+		return val, nil
+	}
+	return "", ErrNotString
+}
+
+//StringRep behaves like String but gets the specified repetition of the field
+func (r *Record) StringRep(fieldName string, repetition int) string {
+	s, _ := r.StringRepE(fieldName, repetition)
+	return s
+}
+
+//IntRepE behaves like IntE but gets the specified repetition of the field
+func (r *Record) IntRepE(fieldName string, repetition int) (int, error) {
+	f, err := r.Float64RepE(fieldName, repetition)
+	return int(f), err
+}
+
+//IntRep behaves like Int but gets the specified repetition of the field
+func (r *Record) IntRep(fieldName string, repetition int) int {
+	i, _ := r.IntRepE(fieldName, repetition)
+	return i
+}
+
+//Float64RepE behaves like Float64E but gets the specified repetition of the field
+func (r *Record) Float64RepE(fieldName string, repetition int) (float64, error) {
+	if val, ok := r.GetRep(fieldName, repetition).(float64); ok {
+		return val, nil
+	}
+	return 0, ErrNotNumber
+}
+
+//Float64Rep behaves like Float64 but gets the specified repetition of the field
+func (r *Record) Float64Rep(fieldName string, repetition int) float64 {
+	f, _ := r.Float64RepE(fieldName, repetition)
+	return f
+}
+
+//BoolRep behaves like Bool but gets the specified repetition of the field
+func (r *Record) BoolRep(fieldName string, repetition int) bool {
+	switch val := r.GetRep(fieldName, repetition).(type) {
+	case string:
+		return len(val) > 0
+	case float64:
+		return val > 0
+	}
+	return false
+}
+
+//TimeRepE behaves like TimeE but gets the specified repetition of the field
+func (r *Record) TimeRepE(fieldName string, repetition int, loc *time.Location) (time.Time, error) {
+	return parseTime(r.StringRep(fieldName, repetition), loc, r.Session.timeLayouts())
+}
+
+//TimeRep behaves like Time but gets the specified repetition of the field
+func (r *Record) TimeRep(fieldName string, repetition int, loc *time.Location) time.Time {
+	t, _ := r.TimeRepE(fieldName, repetition, loc)
+	return t
+}
+
+//FieldUnmarshaler is implemented by types that can map field data themselves. The data is the
+//value in the Data API response, i.e. a string or a float64.
+type FieldUnmarshaler interface {
+	UnmarshalFileMaker(data interface{}) error
+}
+
+//FieldMarshaler is implemented by types that can stage field data themselves. The returned value
+//is set as by Record.Set.
+type FieldMarshaler interface {
+	MarshalFileMaker() (interface{}, error)
+}
+
 /*
 Map takes a struct and inserts the field data of the record
 in the struct fields with an `fm`-tag matching the record field name.
@@ -603,6 +1030,8 @@ type example struct {
 
 - Nested structs are not supported.
 
+- The record ID and modification ID are mapped to string fields tagged `fm:"@recordId"` and `fm:"@modId"`.
+
 Supported types:
 
 - string
@@ -624,10 +1053,44 @@ Supported types:
 - bool
 
 - time.Time (date and timestamp fields)
+
+- Pointers to the types above, left nil when the field is empty
+
+- Named types with an underlying string, integer, unsigned integer, float or bool kind
+
+- Types implementing FieldUnmarshaler, encoding.TextUnmarshaler or json.Unmarshaler
+
+- Slices and arrays of the types above, mapped from the repetitions of the field. Byte slices and
+arrays are ignored.
+
+- Slices of structs or pointers to structs tagged `fm:"portal:Name"`, mapped from the related
+records in the portal. The tags of the nested struct use fully qualified field names
+(`fm:"Table::Field"`) and `fm:"@recordId"` holds the ID of the related record.
 */
 func (r *Record) Map(obj interface{}, timeLoc *time.Location) {
-	v := reflect.ValueOf(obj).Elem()
+	r.mapStruct(reflect.ValueOf(obj).Elem(), timeLoc, "", nil)
+}
+
+/*
+MapE behaves like Map but also returns a *MapError listing every struct field that could not be
+mapped, e.g. because the tag doesn't match a field in the record (ErrUnknownField), the field data
+has another type than the struct field (ErrNotString, ErrNotNumber) or a date couldn't be parsed.
+Empty fields are mapped to zero values without errors. Fields that fail are still set as by Map.
+*/
+func (r *Record) MapE(obj interface{}, timeLoc *time.Location) error {
+	var errs []*FieldError
+	r.mapStruct(reflect.ValueOf(obj).Elem(), timeLoc, "", &errs)
 
+	if len(errs) > 0 {
+		return &MapError{errs}
+	}
+
+	return nil
+}
+
+//mapStruct maps the field data of the record to the fields of the struct value, appending the
+//fields that fail to errs unless it is nil
+func (r *Record) mapStruct(v reflect.Value, timeLoc *time.Location, path string, errs *[]*FieldError) {
 	//Loop through all struct fields
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
@@ -637,46 +1100,534 @@ func (r *Record) Map(obj interface{}, timeLoc *time.Location) {
 			continue
 		}
 
-		//Get the `fm` tag of the field
-		tag := v.Type().Field(i).Tag.Get("fm")
+		//Get the field name in the `fm` tag of the field
+		tag, _ := parseTag(v.Type().Field(i).Tag.Get("fm"))
+		name := path + v.Type().Field(i).Name
 
-		//Set the struct field value depending on the underlying type
-		switch field.Interface().(type) {
-		case string:
-			field.SetString(r.String(tag))
-		case int, int8, int16, int32, int64:
-			field.SetInt(r.Int64(tag))
-		case float32, float64:
-			field.SetFloat(r.Float64(tag))
-		case bool:
-			field.SetBool(r.Bool(tag))
-		case time.Time:
-			field.Set(reflect.ValueOf(r.Time(tag, timeLoc)))
-		}
-
-		if field.Kind() == reflect.Struct {
+		//Set the record ID and modification ID
+		if tag == TagRecordID && field.Kind() == reflect.String {
+			field.SetString(r.ID)
+			continue
+		} else if tag == TagModID && field.Kind() == reflect.String {
+			field.SetString(r.ModID)
+			continue
+		}
+
+		if field.Kind() == reflect.Struct && !isUnmarshaler(field.Addr().Type()) {
 			//Map nested struct
-			r.Map(field.Addr().Interface(), timeLoc)
+			r.mapStruct(field, timeLoc, name+".", errs)
 			continue
-		} else if field.Kind() == reflect.Pointer && field.Elem().Kind() == reflect.Struct {
+		} else if field.Kind() == reflect.Pointer && !field.IsNil() &&
+			field.Elem().Kind() == reflect.Struct && !isUnmarshaler(field.Type()) {
 			//Map nested pointer to struct
-			r.Map(field.Interface(), timeLoc)
+			r.mapStruct(field.Elem(), timeLoc, name+".", errs)
+			continue
+		}
+
+		if tag == "" {
+			continue
+		}
+
+		//Map slices of structs from the related records in the portal
+		if strings.HasPrefix(tag, TagPortalPrefix) {
+			r.mapPortal(field, strings.TrimPrefix(tag, TagPortalPrefix), timeLoc, name, errs)
+			continue
+		}
+
+		//Map slices and arrays from the repetitions of the field
+		if isRepetitions(field.Type()) && !isUnmarshaler(field.Addr().Type()) {
+			r.mapRepetitions(field, tag, timeLoc, name, errs)
+			continue
+		}
+
+		//Set the struct field value, reporting fields missing from the record rather than their type
+		err := r.mapValue(field, r.Get(tag), timeLoc)
+		if !r.hasField(tag) {
+			err = ErrUnknownField
+		}
+		if err != nil && errs != nil {
+			*errs = append(*errs, &FieldError{Field: name, Tag: tag, Err: err})
+		}
+	}
+}
+
+//mapPortal sets the slice struct field to the related records in the portal, mapping each related
+//record to a struct or pointer to a struct using the fully qualified field names in its tags
+func (r *Record) mapPortal(
+	field reflect.Value,
+	portal string,
+	timeLoc *time.Location,
+	name string,
+	errs *[]*FieldError,
+) {
+	rows, ok := r.PortalData[portal]
+	if !ok && errs != nil {
+		*errs = append(*errs, &FieldError{Field: name, Tag: TagPortalPrefix + portal, Err: ErrUnknownField})
+	}
+	if field.Kind() != reflect.Slice {
+		return
+	}
+
+	field.Set(reflect.MakeSlice(field.Type(), len(rows), len(rows)))
+	for i := range rows {
+		elem := field.Index(i)
+		if elem.Kind() == reflect.Pointer {
+			elem.Set(reflect.New(elem.Type().Elem()))
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct {
+			rows[i].mapStruct(elem, timeLoc, fmt.Sprintf("%s[%d].", name, i), errs)
+		}
+	}
+}
+
+//mapRepetitions sets the elements of the slice or array struct field to the repetitions of the
+//field, where slices get the length of the number of repetitions returned by the host
+func (r *Record) mapRepetitions(
+	field reflect.Value,
+	tag string,
+	timeLoc *time.Location,
+	name string,
+	errs *[]*FieldError,
+) {
+	n := r.Repetitions(tag)
+	if field.Kind() == reflect.Slice {
+		field.Set(reflect.MakeSlice(field.Type(), n, n))
+	}
+
+	if n == 0 && errs != nil {
+		*errs = append(*errs, &FieldError{Field: name, Tag: tag, Err: ErrUnknownField})
+	}
+
+	for i := 0; i < field.Len() && i < n; i++ {
+		err := r.mapValue(field.Index(i), r.GetRep(tag, i+1), timeLoc)
+		if err != nil && errs != nil {
+			*errs = append(*errs, &FieldError{
+				Field: fmt.Sprintf("%s[%d]", name, i),
+				Tag:   repFieldName(tag, i+1),
+				Err:   err,
+			})
+		}
+	}
+}
+
+//isRepetitions returns true if the type is a slice or array holding the repetitions of a field,
+//which excludes byte slices and arrays
+func isRepetitions(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+//hasField returns true if the record has the specified field
+func (r *Record) hasField(fieldName string) bool {
+	if _, ok := r.StagedChanges[fieldName]; ok {
+		return true
+	}
+	_, ok := r.FieldData[fieldName]
+	return ok
+}
+
+//mapValue sets the struct field to the field data depending on the type of the struct field
+func (r *Record) mapValue(field reflect.Value, data interface{}, timeLoc *time.Location) error {
+	//Empty number, date and timestamp fields are returned as empty strings
+	empty := data == ""
+
+	if field.Type() == reflect.TypeOf(&time.Time{}) {
+		val, ok := data.(string)
+		t, err := parseTime(val, timeLoc, r.Session.timeLayouts())
+
+		//Only set time pointers if time is not zero
+		if !t.IsZero() {
+			field.Set(reflect.ValueOf(&t))
+		}
+
+		if !ok {
+			return ErrNotString
+		} else if err != nil && !empty {
+			return err
+		}
+		return nil
+	}
+
+	//Pointers are only allocated for fields that aren't empty
+	if field.Kind() == reflect.Pointer {
+		if data == nil || empty {
+			return nil
+		}
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return r.mapValue(field.Elem(), data, timeLoc)
+	}
+
+	//Custom types unmarshal the field data themselves
+	if u, ok := field.Addr().Interface().(FieldUnmarshaler); ok {
+		return u.UnmarshalFileMaker(data)
+	}
+
+	if field.Type() == reflect.TypeOf(time.Time{}) {
+		val, ok := data.(string)
+		t, err := parseTime(val, timeLoc, r.Session.timeLayouts())
+		field.Set(reflect.ValueOf(t))
+
+		if !ok {
+			return ErrNotString
+		} else if err != nil && !empty {
+			return err
+		}
+		return nil
+	}
+
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if data == nil || empty {
+			return nil
+		}
+		text, ok := data.(string)
+		if val, isNumber := data.(float64); isNumber {
+			text, ok = strconv.FormatFloat(val, 'f', -1, 64), true
+		}
+		if !ok {
+			return ErrNotString
+		}
+		return u.UnmarshalText([]byte(text))
+	}
+
+	if u, ok := field.Addr().Interface().(json.Unmarshaler); ok {
+		if data == nil || empty {
+			return nil
+		}
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalJSON(b)
+	}
+
+	//Set the struct field value depending on the underlying kind, including named types
+	switch field.Kind() {
+	case reflect.String:
+		val, ok := data.(string)
+		field.SetString(val)
+		if !ok {
+			return ErrNotString
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val, ok := data.(float64)
+		field.SetInt(int64(val))
+		if !ok && !empty {
+			return ErrNotNumber
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val, ok := data.(float64)
+		field.SetUint(uint64(val))
+		if !ok && !empty {
+			return ErrNotNumber
+		}
+	case reflect.Float32, reflect.Float64:
+		val, ok := data.(float64)
+		field.SetFloat(val)
+		if !ok && !empty {
+			return ErrNotNumber
+		}
+	case reflect.Bool:
+		switch val := data.(type) {
+		case string:
+			field.SetBool(len(val) > 0)
+		case float64:
+			field.SetBool(val > 0)
+		default:
+			field.SetBool(false)
+		}
+	}
+
+	return nil
+}
+
+//isUnmarshaler returns true if the type unmarshals field data itself
+func isUnmarshaler(t reflect.Type) bool {
+	return t.Implements(reflect.TypeOf((*FieldUnmarshaler)(nil)).Elem()) ||
+		t.Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) ||
+		t.Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem())
+}
+
+//Layouts of the date, time and timestamp formats used by the data API by default
+const (
+	dateLayout      = "01/02/2006"
+	timeLayout      = "15:04:05"
+	timestampLayout = "01/02/2006 15:04:05"
+)
+
+//parseTag splits an `fm` tag into the field name and any comma separated options
+func parseTag(tag string) (string, map[string]bool) {
+	parts := strings.Split(tag, ",")
+	options := make(map[string]bool)
+	for _, option := range parts[1:] {
+		options[strings.TrimSpace(option)] = true
+	}
+
+	return parts[0], options
+}
+
+/*
+SetFrom is the reverse of Map, it takes a struct and stages changes to the record fields matching
+the `fm`-tags of the struct fields, using the same types as Map. Nested structs are handled the
+same way as by Map.
+
+Tag options are specified after the field name, separated by commas:
+
+- `readonly` skips the field, e.g. for calculation fields (`fm:"Total,readonly"`)
+
+- `omitempty` skips the field if it has the zero value of its type
+
+- `date` and `time` format a time.Time as a date or time instead of a timestamp
+
+Zero time.Time values and nil pointers are set as empty fields. Types implementing FieldMarshaler,
+encoding.TextMarshaler or json.Marshaler marshal their own field data. Slices and arrays are set as
+the repetitions of the field, and slices of structs tagged `fm:"portal:Name"` as related records in
+the portal, editing rows with a record ID and adding rows without one. Calling SetFrom again before
+committing replaces the new rows staged before. Related records missing from the slice are kept,
+use DeletePortalRow to delete them. Map the record again after committing to get the IDs of the new
+related records, or they are created again by the next SetFrom and Commit. Time values are
+converted to the specified location before being formatted, unless it is nil.
+
+If the record has no ID, the record ID and modification ID are taken from struct fields tagged
+`fm:"@recordId"` and `fm:"@modId"`, so that a struct mapped from a record can be written back to it.
+A *MapError is returned listing the struct fields whose marshaler failed.
+*/
+func (r *Record) SetFrom(obj interface{}, timeLoc *time.Location) error {
+	var errs []*FieldError
+	r.setFromStruct(reflect.ValueOf(obj), timeLoc, "", r.ID == "", &errs)
+
+	if len(errs) > 0 {
+		return &MapError{errs}
+	}
+
+	return nil
+}
+
+//setFromStruct stages changes to the record from the fields of the struct value, appending the
+//fields that fail to errs
+func (r *Record) setFromStruct(
+	v reflect.Value,
+	timeLoc *time.Location,
+	path string,
+	writeBack bool,
+	errs *[]*FieldError,
+) {
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	//Copy the struct if needed, so methods with pointer receivers can be called on its fields
+	if !v.CanAddr() {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+
+	//Loop through all struct fields
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+
+		//Skip unexported fields
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+
+		tag, options := parseTag(v.Type().Field(i).Tag.Get("fm"))
+		name := path + v.Type().Field(i).Name
+
+		//Write back to the record the struct was mapped from
+		if tag == TagRecordID || tag == TagModID {
+			if writeBack && field.Kind() == reflect.String {
+				if tag == TagRecordID {
+					r.ID = field.String()
+				} else {
+					r.ModID = field.String()
+				}
+			}
+			continue
+		}
+
+		//Set nested structs
+		if tag == "" {
+			if field.Kind() == reflect.Struct && !isMarshaler(field.Addr().Type()) {
+				r.setFromStruct(field, timeLoc, name+".", writeBack, errs)
+			} else if field.Kind() == reflect.Pointer && !field.IsNil() &&
+				field.Elem().Kind() == reflect.Struct && !isMarshaler(field.Type()) {
+				r.setFromStruct(field, timeLoc, name+".", writeBack, errs)
+			}
+			continue
+		}
+
+		if options["readonly"] || (options["omitempty"] && field.IsZero()) {
+			continue
+		}
+
+		//Stage changes to the related records in the portal from slices of structs
+		if strings.HasPrefix(tag, TagPortalPrefix) {
+			r.setPortalFrom(field, strings.TrimPrefix(tag, TagPortalPrefix), timeLoc, name, errs)
 			continue
-		} else if field.Kind() == reflect.Pointer &&
-			field.Type().Elem() == reflect.TypeOf(time.Time{}) {
-			//Field is a time.Time pointer
-			t := r.Time(tag, timeLoc)
-
-			//Only set field if time is not zero
-			if field.IsNil() && !t.IsZero() {
-				//Nil pointer
-				field.Set(reflect.ValueOf(&t))
-			} else if !t.IsZero() {
-				//Value pointer
-				field.Elem().Set(reflect.ValueOf(t))
+		}
+
+		//Set slices and arrays as the repetitions of the field
+		if isRepetitions(field.Type()) && !isMarshaler(field.Addr().Type()) {
+			for i := 0; i < field.Len(); i++ {
+				value, ok, err := marshalValue(field.Index(i), options, timeLoc, r.Session.timeLayouts())
+				if err != nil {
+					*errs = append(*errs, &FieldError{
+						Field: fmt.Sprintf("%s[%d]", name, i),
+						Tag:   repFieldName(tag, i+1),
+						Err:   err,
+					})
+				} else if ok {
+					r.SetRep(tag, i+1, value)
+				}
 			}
+			continue
+		}
 
+		value, ok, err := marshalValue(field, options, timeLoc, r.Session.timeLayouts())
+		if err != nil {
+			*errs = append(*errs, &FieldError{Field: name, Tag: tag, Err: err})
+		} else if ok {
+			r.Set(tag, value)
+		}
+	}
+}
+
+//setPortalFrom stages changes to the related records in the portal from the elements of the slice
+//struct field. Elements with a record ID tagged `fm:"@recordId"` edit the related record with that
+//ID, while elements without one are added as new related records, replacing any new related
+//records staged before so they aren't created twice.
+func (r *Record) setPortalFrom(
+	field reflect.Value,
+	portal string,
+	timeLoc *time.Location,
+	name string,
+	errs *[]*FieldError,
+) {
+	if field.Kind() != reflect.Slice {
+		return
+	}
+
+	//Discard the new related records staged by any previous call
+	var kept []Record
+	for _, row := range r.PortalData[portal] {
+		if row.ID != "" {
+			kept = append(kept, row)
+		}
+	}
+	if _, ok := r.PortalData[portal]; ok {
+		r.PortalData[portal] = kept
+	}
+
+	for i := 0; i < field.Len(); i++ {
+		elem := field.Index(i)
+		if elem.Kind() == reflect.Pointer && !elem.IsNil() {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			continue
+		}
+
+		row := Record{StagedChanges: make(map[string]interface{}), Session: r.Session}
+		row.setFromStruct(elem, timeLoc, fmt.Sprintf("%s[%d].", name, i), true, errs)
+
+		if row.ID == "" {
+			if len(row.StagedChanges) > 0 {
+				r.AddPortalRow(portal, row.StagedChanges)
+			}
 			continue
 		}
+		for fieldName, value := range row.StagedChanges {
+			r.SetPortalRow(portal, row.ID, fieldName, value)
+		}
+	}
+}
+
+//marshalValue returns the field data for the struct field depending on the type of the struct
+//field, or false if the type is not supported
+func marshalValue(
+	field reflect.Value,
+	options map[string]bool,
+	timeLoc *time.Location,
+	layouts dateLayouts,
+) (interface{}, bool, error) {
+	//Dereference pointers, nil pointers are set as empty fields
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return "", true, nil
+		}
+		field = field.Elem()
+	}
+
+	//Custom types marshal the field data themselves
+	if m, ok := field.Addr().Interface().(FieldMarshaler); ok {
+		value, err := m.MarshalFileMaker()
+		return value, true, err
+	}
+
+	if val, ok := field.Interface().(time.Time); ok {
+		if val.IsZero() {
+			return "", true, nil
+		}
+
+		if timeLoc != nil {
+			val = val.In(timeLoc)
+		}
+
+		if options["date"] {
+			return val.Format(layouts.date), true, nil
+		} else if options["time"] {
+			return val.Format(layouts.time), true, nil
+		}
+		return val.Format(layouts.timestamp), true, nil
 	}
+
+	if m, ok := field.Addr().Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), true, err
+	}
+
+	if m, ok := field.Addr().Interface().(json.Marshaler); ok {
+		b, err := m.MarshalJSON()
+		if err != nil {
+			return nil, true, err
+		}
+
+		//Set json strings, numbers and bools as their values and anything else as json text
+		var value interface{}
+		if err := json.Unmarshal(b, &value); err == nil {
+			switch value.(type) {
+			case string, float64, bool:
+				return value, true, nil
+			case nil:
+				return "", true, nil
+			}
+		}
+		return string(b), true, nil
+	}
+
+	//Get the value depending on the underlying kind, including named types
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int(), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint()), true, nil
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), true, nil
+	case reflect.Bool:
+		return field.Bool(), true, nil
+	}
+
+	return nil, false, nil
+}
+
+//isMarshaler returns true if the type marshals field data itself
+func isMarshaler(t reflect.Type) bool {
+	return t.Implements(reflect.TypeOf((*FieldMarshaler)(nil)).Elem()) ||
+		t.Implements(reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()) ||
+		t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem())
 }
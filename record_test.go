@@ -1,6 +1,9 @@
 package filemaker
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -32,7 +35,7 @@ func newTestRecord() Record {
 				"time_invalid":        "january 1 2006 15 pm",
 			},
 		},
-		Session{
+		&Session{
 			Token:    "token",
 			Host:     "host",
 			Database: "database",
@@ -288,3 +291,524 @@ func TestRecordMap(t *testing.T) {
 		}
 	})
 }
+
+//TestRecordPortal tests reading the related records in the portals of a record
+func TestRecordPortal(t *testing.T) {
+	record := newRecord(
+		"layout",
+		map[string]interface{}{
+			"recordId":  "1",
+			"modId":     "4",
+			"fieldData": map[string]interface{}{"Name": "Order"},
+			"portalData": map[string]interface{}{
+				"Lines": []interface{}{
+					map[string]interface{}{"recordId": "10", "modId": "2", "Lines::Qty": float64(3)},
+					map[string]interface{}{"recordId": "11", "modId": "0", "Lines::Qty": float64(5)},
+				},
+				"Notes": []interface{}{},
+			},
+			"portalDataInfo": []interface{}{
+				map[string]interface{}{
+					"portalObjectName": "Lines",
+					"database":         "database",
+					"table":            "Lines",
+					"foundCount":       float64(2),
+					"returnedCount":    float64(2),
+				},
+			},
+		},
+		&Session{},
+	)
+
+	t.Run("mod_id", func(t *testing.T) {
+		got := record.ModID
+		expect := "4"
+		if got != expect {
+			t.Errorf("got: '%v', expected: '%v'", got, expect)
+		}
+	})
+
+	t.Run("portals", func(t *testing.T) {
+		got := record.Portals()
+		if len(got) != 2 || got[0] != "Lines" || got[1] != "Notes" {
+			t.Errorf("got: %v, expected: %v", got, []string{"Lines", "Notes"})
+		}
+	})
+
+	t.Run("rows", func(t *testing.T) {
+		rows := record.Portal("Lines")
+		if len(rows) != 2 {
+			t.Fatalf("got: %v rows, expected: %v", len(rows), 2)
+		}
+		if rows[0].ID != "10" || rows[0].ModID != "2" || rows[0].Int("Lines::Qty") != 3 {
+			t.Errorf("got: %+v", rows[0])
+		}
+		if _, ok := rows[0].FieldData["recordId"]; ok {
+			t.Errorf("expected record ID not to be part of the field data")
+		}
+	})
+
+	t.Run("info", func(t *testing.T) {
+		got := record.PortalDataInfo["Lines"]
+		if got.Table != "Lines" || got.FoundCount != 2 {
+			t.Errorf("got: %+v", got)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		row := record.Portal("Lines")[0]
+		if err := row.Delete(); !errors.Is(err, ErrPortalRow) {
+			t.Errorf("delete: got: %v, expected: %v", err, ErrPortalRow)
+		}
+		row.Set("Lines::Qty", 4)
+		if err := row.Commit(); !errors.Is(err, ErrPortalRow) {
+			t.Errorf("commit: got: %v, expected: %v", err, ErrPortalRow)
+		}
+	})
+}
+
+type testSetFromStruct struct {
+	ID        string     `fm:"@recordId"`
+	ModID     string     `fm:"@modId"`
+	String    string     `fm:"string"`
+	Int       int        `fm:"int"`
+	Float32   float32    `fm:"float32"`
+	Bool      bool       `fm:"bool"`
+	Date      time.Time  `fm:"date,date"`
+	Time      time.Time  `fm:"time,time"`
+	Timestamp time.Time  `fm:"timestamp"`
+	ZeroTime  time.Time  `fm:"zero_time"`
+	NilTime   *time.Time `fm:"nil_time"`
+	NilString *string    `fm:"nil_string"`
+	Pointer   *int       `fm:"pointer"`
+	Readonly  string     `fm:"readonly,readonly"`
+	OmitEmpty string     `fm:"omitempty,omitempty"`
+	Untagged  string
+	Nested    struct {
+		String string `fm:"nested_string"`
+	}
+}
+
+//TestRecordSetFrom tests the `Record.SetFrom` method
+func TestRecordSetFrom(t *testing.T) {
+	pointer := 5
+	value := testSetFromStruct{
+		ID:        "12",
+		ModID:     "3",
+		String:    "string",
+		Int:       100,
+		Float32:   1.5,
+		Bool:      true,
+		Date:      time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		Time:      time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		Timestamp: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		Pointer:   &pointer,
+		Readonly:  "readonly",
+		Untagged:  "untagged",
+	}
+	value.Nested.String = "nested"
+
+	record := Record{StagedChanges: make(map[string]interface{})}
+	if err := record.SetFrom(&value, time.UTC); err != nil {
+		t.Fatalf("got: %v, expected: %v", err, nil)
+	}
+
+	expect := map[string]interface{}{
+		"string":        "string",
+		"int":           float64(100),
+		"float32":       float64(1.5),
+		"bool":          float64(1),
+		"date":          "01/02/2006",
+		"time":          "15:04:05",
+		"timestamp":     "01/02/2006 15:04:05",
+		"zero_time":     "",
+		"nil_time":      "",
+		"nil_string":    "",
+		"pointer":       float64(5),
+		"nested_string": "nested",
+	}
+
+	for fieldName, expectValue := range expect {
+		t.Run(fieldName, func(t *testing.T) {
+			got, ok := record.StagedChanges[fieldName]
+			if !ok || got != expectValue {
+				t.Errorf("got: %#v, expected: %#v", got, expectValue)
+			}
+		})
+	}
+
+	t.Run("skipped", func(t *testing.T) {
+		if len(record.StagedChanges) != len(expect) {
+			t.Errorf("got: %v, expected: %v", record.StagedChanges, expect)
+		}
+	})
+
+	t.Run("ids", func(t *testing.T) {
+		if record.ID != "12" || record.ModID != "3" {
+			t.Errorf("got: '%v' and '%v', expected: '12' and '3'", record.ID, record.ModID)
+		}
+	})
+}
+
+//TestRecordMapE tests the errors returned by the `Record.MapE` method
+func TestRecordMapE(t *testing.T) {
+	record := newTestRecord()
+	record.FieldData["empty_number"] = ""
+
+	var value struct {
+		String      string    `fm:"string"`
+		EmptyNumber int       `fm:"empty_number"`
+		Misspelled  string    `fm:"strnig"`
+		NotNumber   int       `fm:"string"`
+		NotString   string    `fm:"int"`
+		TimeInvalid time.Time `fm:"time_invalid"`
+		Nested      struct {
+			Missing float64 `fm:"missing"`
+		}
+	}
+
+	err := record.MapE(&value, time.UTC)
+
+	var mapErr *MapError
+	if !errors.As(err, &mapErr) {
+		t.Fatalf("got: %v, expected: %T", err, mapErr)
+	}
+
+	expect := map[string]error{
+		"Misspelled":     ErrUnknownField,
+		"NotNumber":      ErrNotNumber,
+		"NotString":      ErrNotString,
+		"TimeInvalid":    ErrUnknownFormat,
+		"Nested.Missing": ErrUnknownField,
+	}
+
+	t.Run("count", func(t *testing.T) {
+		if len(mapErr.Errors) != len(expect) {
+			t.Errorf("got: %v, expected: %v errors", mapErr, len(expect))
+		}
+	})
+
+	for _, fieldErr := range mapErr.Errors {
+		fieldErr := fieldErr
+		t.Run(fieldErr.Field, func(t *testing.T) {
+			if !errors.Is(fieldErr, expect[fieldErr.Field]) {
+				t.Errorf("got: %v, expected: %v", fieldErr.Err, expect[fieldErr.Field])
+			}
+		})
+	}
+
+	t.Run("is", func(t *testing.T) {
+		//Call the methods directly too, since errors.Is follows Unwrap() []error from Go 1.20
+		if !errors.Is(err, ErrNotNumber) || !mapErr.Is(ErrUnknownField) || mapErr.Is(ErrValueListMissing) {
+			t.Errorf("expected %v to match the errors of its fields only", err)
+		}
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) || !mapErr.As(&fieldErr) || fieldErr.Field != mapErr.Errors[0].Field {
+			t.Errorf("got: %v, expected: %v", fieldErr, mapErr.Errors[0])
+		}
+	})
+
+	t.Run("mapped", func(t *testing.T) {
+		if value.String != "string" {
+			t.Errorf("got: '%v', expected: '%v'", value.String, "string")
+		}
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		var valid struct {
+			String string `fm:"string"`
+			Int    int    `fm:"int"`
+		}
+		if err := record.MapE(&valid, time.UTC); err != nil {
+			t.Errorf("got: %v, expected: %v", err, nil)
+		}
+	})
+}
+
+//testStatus is a named string type used as an enum
+type testStatus string
+
+//testCode is a type implementing encoding.TextUnmarshaler and encoding.TextMarshaler
+type testCode struct {
+	Prefix string
+	Number string
+}
+
+func (c *testCode) UnmarshalText(text []byte) error {
+	parts := strings.SplitN(string(text), "-", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid code: %v", string(text))
+	}
+	c.Prefix, c.Number = parts[0], parts[1]
+	return nil
+}
+
+func (c testCode) MarshalText() ([]byte, error) {
+	return []byte(c.Prefix + "-" + c.Number), nil
+}
+
+//testMoney is a type implementing FieldUnmarshaler and FieldMarshaler, storing amounts in cents
+type testMoney int64
+
+func (m *testMoney) UnmarshalFileMaker(data interface{}) error {
+	val, ok := data.(float64)
+	if !ok {
+		return ErrNotNumber
+	}
+	*m = testMoney(val*100 + 0.5)
+	return nil
+}
+
+func (m testMoney) MarshalFileMaker() (interface{}, error) {
+	return float64(m) / 100, nil
+}
+
+//testCustomStruct contains fields of custom types
+type testCustomStruct struct {
+	Status  testStatus  `fm:"string"`
+	Count   uint        `fm:"int"`
+	Code    testCode    `fm:"code"`
+	CodePtr *testCode   `fm:"code"`
+	Money   testMoney   `fm:"float"`
+	Empty   *testStatus `fm:"empty"`
+}
+
+//TestRecordCustomTypes tests mapping to and setting from custom types
+func TestRecordCustomTypes(t *testing.T) {
+	record := newTestRecord()
+	record.FieldData["code"] = "AB-123"
+	record.FieldData["float"] = 12.34
+	record.FieldData["empty"] = ""
+
+	var value testCustomStruct
+	if err := record.MapE(&value, time.UTC); err != nil {
+		t.Fatalf("got: %v, expected: %v", err, nil)
+	}
+
+	code := testCode{"AB", "123"}
+	expect := testCustomStruct{
+		Status:  "string",
+		Count:   uint(record.FieldData["int"].(float64)),
+		Code:    code,
+		CodePtr: &code,
+		Money:   1234,
+	}
+
+	t.Run("map", func(t *testing.T) {
+		if value.Status != expect.Status || value.Count != expect.Count || value.Code != expect.Code ||
+			value.CodePtr == nil || *value.CodePtr != code || value.Money != expect.Money || value.Empty != nil {
+			t.Errorf("got: %+v, expected: %+v", value, expect)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		record.FieldData["code"] = "invalid"
+		var invalid struct {
+			Code testCode `fm:"code"`
+		}
+		var mapErr *MapError
+		if err := record.MapE(&invalid, time.UTC); !errors.As(err, &mapErr) || mapErr.Errors[0].Field != "Code" {
+			t.Errorf("got: %v, expected: %T for field Code", err, mapErr)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		set := Record{StagedChanges: make(map[string]interface{})}
+		if err := set.SetFrom(&value, time.UTC); err != nil {
+			t.Fatalf("got: %v, expected: %v", err, nil)
+		}
+
+		expect := map[string]interface{}{
+			"string": "string",
+			"int":    record.FieldData["int"],
+			"code":   "AB-123",
+			"float":  12.34,
+			"empty":  "",
+		}
+		for fieldName, expectValue := range expect {
+			if got := set.StagedChanges[fieldName]; got != expectValue {
+				t.Errorf("%v: got: %#v, expected: %#v", fieldName, got, expectValue)
+			}
+		}
+	})
+}
+
+//TestRecordRepetitions tests getting, setting and mapping the repetitions of repeating fields
+func TestRecordRepetitions(t *testing.T) {
+	record := newTestRecord()
+	record.FieldData["rep"] = "one"
+	record.FieldData["rep(2)"] = "two"
+	record.FieldData["rep(3)"] = ""
+	record.FieldData["num"] = float64(1)
+	record.FieldData["num(2)"] = float64(2)
+
+	t.Run("getters", func(t *testing.T) {
+		if got := record.Repetitions("rep"); got != 3 {
+			t.Errorf("got: %v repetitions, expected: %v", got, 3)
+		}
+		if got := record.StringRep("rep", 1); got != "one" {
+			t.Errorf("got: '%v', expected: '%v'", got, "one")
+		}
+		if got := record.StringRep("rep", 2); got != "two" {
+			t.Errorf("got: '%v', expected: '%v'", got, "two")
+		}
+		if got := record.IntRep("num", 2); got != 2 {
+			t.Errorf("got: '%v', expected: '%v'", got, 2)
+		}
+		if _, err := record.Float64RepE("num", 3); !errors.Is(err, ErrNotNumber) {
+			t.Errorf("got: %v, expected: %v", err, ErrNotNumber)
+		}
+	})
+
+	t.Run("map", func(t *testing.T) {
+		var value struct {
+			Slice   []string   `fm:"rep"`
+			Array   [2]int     `fm:"num"`
+			Missing []string   `fm:"missing"`
+			Ptrs    []*float64 `fm:"num"`
+		}
+		err := record.MapE(&value, time.UTC)
+
+		var mapErr *MapError
+		if !errors.As(err, &mapErr) || len(mapErr.Errors) != 1 || mapErr.Errors[0].Field != "Missing" {
+			t.Errorf("got: %v, expected: error for field Missing", err)
+		}
+		if len(value.Slice) != 3 || value.Slice[0] != "one" || value.Slice[1] != "two" || value.Slice[2] != "" {
+			t.Errorf("got: %#v, expected: %#v", value.Slice, []string{"one", "two", ""})
+		}
+		if value.Array != [2]int{1, 2} {
+			t.Errorf("got: %v, expected: %v", value.Array, [2]int{1, 2})
+		}
+		if len(value.Ptrs) != 2 || *value.Ptrs[1] != 2 {
+			t.Errorf("got: %v, expected: 2 repetitions", value.Ptrs)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		var value struct {
+			Bytes []byte `fm:"string"`
+		}
+		if err := record.MapE(&value, time.UTC); err != nil || value.Bytes != nil {
+			t.Errorf("got: %v (%v), expected byte slice to be ignored", value.Bytes, err)
+		}
+
+		set := Record{StagedChanges: make(map[string]interface{})}
+		value.Bytes = []byte("text")
+		if err := set.SetFrom(&value, time.UTC); err != nil || len(set.StagedChanges) != 0 {
+			t.Errorf("got: %v (%v), expected byte slice to be ignored", set.StagedChanges, err)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		set := Record{StagedChanges: make(map[string]interface{})}
+		set.SetRep("single", 3, 3)
+
+		value := struct {
+			Slice []string `fm:"rep"`
+			Array [2]int   `fm:"num"`
+		}{[]string{"a", "b"}, [2]int{5, 6}}
+		if err := set.SetFrom(&value, time.UTC); err != nil {
+			t.Fatalf("got: %v, expected: %v", err, nil)
+		}
+
+		expect := map[string]interface{}{
+			"single(3)": float64(3),
+			"rep":       "a",
+			"rep(2)":    "b",
+			"num":       float64(5),
+			"num(2)":    float64(6),
+		}
+		if len(set.StagedChanges) != len(expect) {
+			t.Errorf("got: %v, expected: %v", set.StagedChanges, expect)
+		}
+		for fieldName, expectValue := range expect {
+			if got := set.StagedChanges[fieldName]; got != expectValue {
+				t.Errorf("%v: got: %#v, expected: %#v", fieldName, got, expectValue)
+			}
+		}
+	})
+}
+
+//testLineItem is a related record in the Lines portal
+type testLineItem struct {
+	ID    string `fm:"@recordId"`
+	ModID string `fm:"@modId"`
+	Qty   int    `fm:"Lines::Qty"`
+}
+
+//TestRecordMapPortal tests mapping portals to and setting them from slices of structs
+func TestRecordMapPortal(t *testing.T) {
+	record := newRecord(
+		"layout",
+		map[string]interface{}{
+			"recordId":  "1",
+			"fieldData": map[string]interface{}{"Name": "Order"},
+			"portalData": map[string]interface{}{
+				"Lines": []interface{}{
+					map[string]interface{}{"recordId": "10", "modId": "2", "Lines::Qty": float64(3)},
+					map[string]interface{}{"recordId": "11", "modId": "0", "Lines::Qty": float64(5)},
+				},
+			},
+		},
+		&Session{},
+	)
+
+	var value struct {
+		Name     string          `fm:"Name"`
+		Lines    []testLineItem  `fm:"portal:Lines"`
+		Pointers []*testLineItem `fm:"portal:Lines,readonly"`
+		Missing  []testLineItem  `fm:"portal:Missing"`
+	}
+	err := record.MapE(&value, time.UTC)
+
+	t.Run("error", func(t *testing.T) {
+		var mapErr *MapError
+		if !errors.As(err, &mapErr) || len(mapErr.Errors) != 1 || mapErr.Errors[0].Field != "Missing" {
+			t.Errorf("got: %v, expected: error for field Missing", err)
+		}
+	})
+
+	t.Run("map", func(t *testing.T) {
+		expect := []testLineItem{{"10", "2", 3}, {"11", "0", 5}}
+		if len(value.Lines) != 2 || value.Lines[0] != expect[0] || value.Lines[1] != expect[1] {
+			t.Errorf("got: %+v, expected: %+v", value.Lines, expect)
+		}
+		if len(value.Pointers) != 2 || *value.Pointers[1] != expect[1] {
+			t.Errorf("got: %+v, expected: %+v", value.Pointers, expect)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		value.Lines[1].Qty = 6
+		value.Lines = append(value.Lines, testLineItem{Qty: 1})
+		if err := record.SetFrom(&value, time.UTC); err != nil {
+			t.Fatalf("got: %v, expected: %v", err, nil)
+		}
+
+		rows := record.Portal("Lines")
+		if len(rows) != 3 {
+			t.Fatalf("got: %v rows, expected: %v", len(rows), 3)
+		}
+		if got := rows[1].StagedChanges["Lines::Qty"]; got != float64(6) {
+			t.Errorf("got: %v, expected: %v", got, 6)
+		}
+		if rows[2].ID != "" || rows[2].StagedChanges["Lines::Qty"] != float64(1) {
+			t.Errorf("got: %+v, expected new row with quantity 1", rows[2])
+		}
+	})
+
+	t.Run("set_twice", func(t *testing.T) {
+		value.Lines[2].Qty = 2
+		if err := record.SetFrom(&value, time.UTC); err != nil {
+			t.Fatalf("got: %v, expected: %v", err, nil)
+		}
+
+		rows := record.Portal("Lines")
+		if len(rows) != 3 {
+			t.Fatalf("got: %v rows, expected: %v", len(rows), 3)
+		}
+		if rows[2].ID != "" || rows[2].StagedChanges["Lines::Qty"] != float64(2) {
+			t.Errorf("got: %+v, expected new row with quantity 2", rows[2])
+		}
+	})
+}
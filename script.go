@@ -0,0 +1,105 @@
+package filemaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ScriptResults represents the results and error codes of the scripts run as part of a request.
+// The prerequest script runs before the request is processed, the presort script runs before the
+// records are sorted and the script runs after the request has been processed.
+type ScriptResults struct {
+	Result           string
+	Error            int
+	PrerequestResult string
+	PrerequestError  int
+	PresortResult    string
+	PresortError     int
+}
+
+// ScriptError is returned when a script run as part of a request fails, with the phase being
+// either "script.prerequest", "script.presort" or "script"
+type ScriptError struct {
+	Phase  string
+	Code   int
+	Result string
+}
+
+// Error implements the error interface
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("failed to run %v: script error (%v)", e.Phase, e.Code)
+}
+
+// newScriptResults parses the script results in a response body
+func newScriptResults(jsonRes ResponseBody) ScriptResults {
+	var results = ScriptResults{
+		Result:           jsonRes.Response.ScriptResult,
+		PrerequestResult: jsonRes.Response.ScriptResultPrerequest,
+		PresortResult:    jsonRes.Response.ScriptResultPresort,
+	}
+	results.Error, _ = strconv.Atoi(jsonRes.Response.ScriptError)
+	results.PrerequestError, _ = strconv.Atoi(jsonRes.Response.ScriptErrorPrerequest)
+	results.PresortError, _ = strconv.Atoi(jsonRes.Response.ScriptErrorPresort)
+
+	return results
+}
+
+// Err returns a *ScriptError for the first script that failed, in the order the scripts ran,
+// or nil if all scripts succeeded
+func (r ScriptResults) Err() error {
+	if r.PrerequestError != 0 {
+		return &ScriptError{"script.prerequest", r.PrerequestError, r.PrerequestResult}
+	} else if r.PresortError != 0 {
+		return &ScriptError{"script.presort", r.PresortError, r.PresortResult}
+	} else if r.Error != 0 {
+		return &ScriptError{"script", r.Error, r.Result}
+	}
+
+	return nil
+}
+
+// setScript sets the parameters running the specified script in the specified phase of a request
+func setScript(params map[string]interface{}, phase, script, param string) {
+	params[phase] = script
+	if param != "" {
+		params[phase+".param"] = param
+	} else {
+		delete(params, phase+".param")
+	}
+}
+
+// RunScript runs the specified script in the context of the specified layout, with an optional
+// script parameter, and returns the script result. A *ScriptError containing the script error
+// code is returned if the script fails. Requires FileMaker Server 19 or later.
+func (s *Session) RunScript(layout, script, param string) (string, error) {
+	return s.RunScriptContext(context.Background(), layout, script, param)
+}
+
+// RunScriptContext behaves like RunScript but sends the request using the specified context
+func (s *Session) RunScriptContext(ctx context.Context, layout, script, param string) (string, error) {
+	if layout == "" {
+		return "", errors.New("No layout specified")
+	} else if script == "" {
+		return "", errors.New("No script specified")
+	}
+
+	scriptURL := fmt.Sprintf(
+		"%s/layouts/%s/script/%s",
+		s.baseURL(),
+		url.PathEscape(layout),
+		url.PathEscape(script),
+	)
+	if param != "" {
+		scriptURL += "?" + url.Values{"script.param": []string{param}}.Encode()
+	}
+
+	jsonRes, err := s.request(ctx, "GET", scriptURL, nil, jsonHeader())
+	if err != nil {
+		return "", err
+	}
+
+	return jsonRes.Response.ScriptResult, newScriptResults(jsonRes).Err()
+}
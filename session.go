@@ -2,12 +2,16 @@ package filemaker
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +23,14 @@ type Session struct {
 	Username     string
 	Password     string
 	lastActivity time.Time
+	client       *http.Client
+	transport    http.RoundTripper
+	mu           sync.Mutex
+	loginMu      sync.Mutex
+	valueLists   map[string][]ValueList
+	dateFormat   DateFormat
+	layouts      dateLayouts
+	globals      map[string]interface{}
 }
 
 // ResponseBody represents the json body received from http requests to the filemaker api
@@ -28,23 +40,58 @@ type ResponseBody struct {
 		Message string `json:"message"`
 	} `json:"messages"`
 	Response struct {
-		Token    string `json:"token"`
-		ModID    string `json:"modId"`
-		RecordID string `json:"recordId"`
-		DataInfo struct {
-			Database         string `json:"database"`
-			Layout           string `json:"layout"`
-			Table            string `json:"table"`
-			TotalRecordCount int    `json:"totalRecordCount"`
-			FoundCount       int    `json:"foundCount"`
-			ReturnedCount    int    `json:"returnedCount"`
-		} `json:"dataInfo"`
-		Data []interface{} `json:"data"`
+		Token    string        `json:"token"`
+		ModID    string        `json:"modId"`
+		RecordID string        `json:"recordId"`
+		DataInfo DataInfo      `json:"dataInfo"`
+		Data     []interface{} `json:"data"`
+
+		ScriptResult           string `json:"scriptResult"`
+		ScriptError            string `json:"scriptError"`
+		ScriptResultPrerequest string `json:"scriptResult.prerequest"`
+		ScriptErrorPrerequest  string `json:"scriptError.prerequest"`
+		ScriptResultPresort    string `json:"scriptResult.presort"`
+		ScriptErrorPresort     string `json:"scriptError.presort"`
+
+		LayoutMetadata
+
+		Layouts     []LayoutInfo   `json:"layouts"`
+		Scripts     []ScriptInfo   `json:"scripts"`
+		Databases   []DatabaseInfo `json:"databases"`
+		ProductInfo Product        `json:"productInfo"`
 	} `json:"response"`
 }
 
+// DataInfo represents the information about the found set returned from requests for records
+type DataInfo struct {
+	Database         string `json:"database"`
+	Layout           string `json:"layout"`
+	Table            string `json:"table"`
+	TotalRecordCount int    `json:"totalRecordCount"`
+	FoundCount       int    `json:"foundCount"`
+	ReturnedCount    int    `json:"returnedCount"`
+}
+
+// FindResult represents the records returned from a find along with the information about the
+// found set, e.g. the number of records found in total for paging through the results, and the
+// results of any scripts run as part of the find
+type FindResult struct {
+	DataInfo
+	Records []Record
+	Scripts ScriptResults
+}
+
+// httpClient returns the http client used to send requests to the host
+func (s *Session) httpClient() *http.Client {
+	if s.client == nil {
+		return http.DefaultClient
+	}
+
+	return s.client
+}
+
 // baseURL builds the base of the data API URL, containing protocol, host and database
-func (s Session) baseURL() string {
+func (s *Session) baseURL() string {
 	return fmt.Sprintf(
 		"%s/fmi/data/v1/databases/%s",
 		s.Host,
@@ -53,7 +100,7 @@ func (s Session) baseURL() string {
 }
 
 // recordsURL builds a data API URL used to access record(s)
-func (s Session) recordsURL(layout, id string) string {
+func (s *Session) recordsURL(layout, id string) string {
 	base := fmt.Sprintf(
 		"%s/layouts/%s/records",
 		s.baseURL(),
@@ -67,108 +114,395 @@ func (s Session) recordsURL(layout, id string) string {
 	return fmt.Sprintf("%s/%s", base, id)
 }
 
-// Destroy logs out of the database session
-func (s *Session) Destroy() error {
+// jsonHeader returns the header of a request with a json body
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": []string{"application/json"}}
+}
+
+// token returns the current session token
+func (s *Session) token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Token
+}
+
+// send sends a single request to the host using the specified authorization and decodes the
+// response body, returning an error if the host responds with anything other than success
+func (s *Session) send(
+	ctx context.Context,
+	method, url string,
+	body []byte,
+	header http.Header,
+	authorization string,
+) (ResponseBody, error) {
+	var jsonRes ResponseBody
+
 	//Build and send request to the host
-	req, err := http.NewRequest(
-		"DELETE",
-		fmt.Sprintf("%s/sessions/%s", s.baseURL(), s.Token),
-		bytes.NewBuffer([]byte{}),
-	)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return jsonRes, fmt.Errorf("failed to build %s request: %v", method, err.Error())
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	res, err := s.httpClient().Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send DELETE request: %v", err.Error())
+		return jsonRes, fmt.Errorf("failed to send %s request: %w", method, err)
 	}
+	defer res.Body.Close()
 
 	//Update last activity time object in session
+	s.mu.Lock()
 	s.lastActivity = time.Now()
+	s.mu.Unlock()
 
 	//Read the body
 	resBodyBytes, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %v", err.Error())
+		return jsonRes, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	//Unmarshal json body
-	var jsonRes ResponseBody
 	err = json.Unmarshal(resBodyBytes, &jsonRes)
 	if err != nil {
-		return fmt.Errorf("failed to decode response body as json: %v", err.Error())
+		return jsonRes, fmt.Errorf("failed to decode response body as json: %v", err.Error())
 	}
 
-	if jsonRes.Messages[0].Code != "0" {
-		return fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
+	//Check the response code
+	if len(jsonRes.Messages) == 0 {
+		return jsonRes, errors.New("failed at host: no messages in response")
+	} else if jsonRes.Messages[0].Code != "0" {
+		code, _ := strconv.Atoi(jsonRes.Messages[0].Code)
+		return jsonRes, &Error{
+			Code:       code,
+			Message:    jsonRes.Messages[0].Message,
+			StatusCode: res.StatusCode,
+			Method:     method,
+			URL:        url,
+		}
+	}
+
+	return jsonRes, nil
+}
+
+/*
+request sends a request to the host authorized with the session token. If the host responds
+that the token is invalid, which happens after 15 minutes of inactivity, the session logs in
+again using its username and password and the request is retried once.
+*/
+func (s *Session) request(
+	ctx context.Context,
+	method, url string,
+	body []byte,
+	header http.Header,
+) (ResponseBody, error) {
+	token := s.token()
+	jsonRes, err := s.send(ctx, method, url, body, header, "Bearer "+token)
+	if !errors.Is(err, ErrInvalidToken) {
+		return jsonRes, err
+	}
+
+	if err := s.relogin(ctx, token); err != nil {
+		return jsonRes, fmt.Errorf("failed to log in again after invalid token: %w", err)
+	}
+
+	return s.send(ctx, method, url, body, header, "Bearer "+s.token())
+}
+
+// relogin logs in again to replace the expired token, unless a concurrent request already did.
+// The login lock is only held while the token is refreshed, not while requests are retried.
+func (s *Session) relogin(ctx context.Context, expiredToken string) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	if s.token() != expiredToken {
+		return nil
+	}
+
+	newToken, err := s.login(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.Token = newToken
+	globals := make(map[string]interface{}, len(s.globals))
+	for fieldName, value := range s.globals {
+		globals[fieldName] = value
+	}
+	s.mu.Unlock()
+
+	//Global fields only last for the session, set them again for the new one
+	if len(globals) > 0 {
+		requestBody, err := globalsBody(globals)
+		if err == nil {
+			_, err = s.send(ctx, "PATCH", s.globalsURL(), requestBody, jsonHeader(), "Bearer "+newToken)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set global fields again: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// login starts a new database session at the host and returns the token
+func (s *Session) login(ctx context.Context) (string, error) {
+	//Create an empty json body
+	var requestBody, err = json.Marshal(struct{}{})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %v", err.Error())
+	}
+
+	jsonRes, err := s.send(
+		ctx,
+		"POST",
+		fmt.Sprintf("%s/sessions", s.baseURL()),
+		requestBody,
+		jsonHeader(),
+		"Basic "+base64.StdEncoding.EncodeToString([]byte(s.Username+":"+s.Password)),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return jsonRes.Response.Token, nil
+}
+
+// Destroy logs out of the database session
+func (s *Session) Destroy() error {
+	return s.DestroyContext(context.Background())
+}
+
+// DestroyContext behaves like Destroy but sends the request using the specified context
+func (s *Session) DestroyContext(ctx context.Context) error {
+	token := s.token()
+	_, err := s.send(
+		ctx,
+		"DELETE",
+		fmt.Sprintf("%s/sessions/%s", s.baseURL(), token),
+		nil,
+		jsonHeader(),
+		"Bearer "+token,
+	)
+	return err
+}
+
 // Find performs the specified findcommand on the specified layout
 func (s *Session) Find(layout string, findCommand interface{}) ([]Record, error) {
+	return s.FindContext(context.Background(), layout, findCommand)
+}
+
+// FindContext behaves like Find but sends the request using the specified context
+func (s *Session) FindContext(ctx context.Context, layout string, findCommand interface{}) ([]Record, error) {
+	result, err := s.FindWithInfoContext(ctx, layout, findCommand)
+	return result.Records, err
+}
+
+// FindWithInfo behaves like Find but also returns the information about the found set,
+// such as the number of records found, and the results of any scripts run as part of the find.
+// If a script fails, the records are returned along with a *ScriptError.
+func (s *Session) FindWithInfo(layout string, findCommand interface{}) (FindResult, error) {
+	return s.FindWithInfoContext(context.Background(), layout, findCommand)
+}
+
+// FindWithInfoContext behaves like FindWithInfo but sends the request using the specified context
+func (s *Session) FindWithInfoContext(ctx context.Context, layout string, findCommand interface{}) (FindResult, error) {
 	if layout == "" {
-		return nil, errors.New("No layout specified")
+		return FindResult{}, errors.New("No layout specified")
 	}
 
 	//Create the request json body
 	var requestBody, err = json.Marshal(findCommand)
+	if err == nil {
+		requestBody, err = s.withDateFormatBody(requestBody)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %v", err.Error())
+		return FindResult{}, fmt.Errorf("failed to marshal request body: %v", err.Error())
 	}
 
-	//Build and send request to the host
-	req, err := http.NewRequest(
+	jsonRes, err := s.request(
+		ctx,
 		"POST",
 		fmt.Sprintf("%s/layouts/%s/_find", s.baseURL(), layout),
-		bytes.NewBuffer(requestBody),
+		requestBody,
+		jsonHeader(),
 	)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+s.Token)
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send POST request: %v", err.Error())
+
+	//Check for errors
+	if errors.Is(err, ErrNoRecordsMatch) {
+		//No records found, return empty slice along with the results of any scripts
+		result := FindResult{Records: []Record{}, Scripts: newScriptResults(jsonRes)}
+		return result, result.Scripts.Err()
+	} else if err != nil {
+		return FindResult{}, err
 	}
 
-	//Update last activity time object in session
-	s.lastActivity = time.Now()
+	var result = FindResult{
+		DataInfo: jsonRes.Response.DataInfo,
+		Scripts:  newScriptResults(jsonRes),
+	}
 
-	//Read the body
-	resBodyBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err.Error())
+	for _, r := range jsonRes.Response.Data {
+		result.Records = append(result.Records, newRecord(layout, r, s))
 	}
 
-	//Unmarshal json body
-	var jsonRes ResponseBody
-	err = json.Unmarshal(resBodyBytes, &jsonRes)
+	return result, result.Scripts.Err()
+}
+
+// GetRecord gets the record with the specified ID from the specified layout. An error matching
+// ErrRecordMissing is returned if there is no record with the ID. If a script run as part of the
+// request fails, the record is returned along with a *ScriptError.
+func (s *Session) GetRecord(layout, id string, options ...GetOptions) (Record, error) {
+	return s.GetRecordContext(context.Background(), layout, id, options...)
+}
+
+// GetRecordContext behaves like GetRecord but sends the request using the specified context
+func (s *Session) GetRecordContext(ctx context.Context, layout, id string, options ...GetOptions) (Record, error) {
+	if layout == "" {
+		return Record{}, errors.New("No layout specified")
+	} else if id == "" {
+		return Record{}, errors.New("No record ID specified")
+	}
+
+	jsonRes, err := s.request(
+		ctx,
+		"GET",
+		withQuery(s.recordsURL(layout, id), s.withDateFormat(options)),
+		nil,
+		jsonHeader(),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode response body as json: %v", err.Error())
+		return Record{}, err
 	}
 
+	if len(jsonRes.Response.Data) == 0 {
+		return Record{}, ErrRecordMissing
+	}
+
+	record := newRecord(layout, jsonRes.Response.Data[0], s)
+	record.ScriptResults = newScriptResults(jsonRes)
+
+	return record, record.ScriptResults.Err()
+}
+
+// GetRecords gets a range of all records on the specified layout, without performing a find.
+// Use the getoptions to specify the offset, limit and sort order of the records.
+func (s *Session) GetRecords(layout string, options ...GetOptions) ([]Record, error) {
+	return s.GetRecordsContext(context.Background(), layout, options...)
+}
+
+// GetRecordsContext behaves like GetRecords but sends the request using the specified context
+func (s *Session) GetRecordsContext(ctx context.Context, layout string, options ...GetOptions) ([]Record, error) {
+	result, err := s.GetRecordsWithInfoContext(ctx, layout, options...)
+	return result.Records, err
+}
+
+// GetRecordsWithInfo behaves like GetRecords but also returns the information about the records,
+// such as the total number of records in the table, and the results of any scripts run as part of
+// the request. If a script fails, the records are returned along with a *ScriptError.
+func (s *Session) GetRecordsWithInfo(layout string, options ...GetOptions) (FindResult, error) {
+	return s.GetRecordsWithInfoContext(context.Background(), layout, options...)
+}
+
+// GetRecordsWithInfoContext behaves like GetRecordsWithInfo but sends the request using the specified context
+func (s *Session) GetRecordsWithInfoContext(ctx context.Context, layout string, options ...GetOptions) (FindResult, error) {
+	if layout == "" {
+		return FindResult{}, errors.New("No layout specified")
+	}
+
+	jsonRes, err := s.request(
+		ctx,
+		"GET",
+		withQuery(s.recordsURL(layout, ""), s.withDateFormat(options)),
+		nil,
+		jsonHeader(),
+	)
+
 	//Check for errors
-	if jsonRes.Messages[0].Code == "401" {
-		//No records found, return empty slice
-		return []Record{}, nil
-	} else if jsonRes.Messages[0].Code != "0" {
-		//Unknown error
-		return nil, fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
+	if errors.Is(err, ErrNoRecordsMatch) {
+		//No records found, return empty slice along with the results of any scripts
+		result := FindResult{Records: []Record{}, Scripts: newScriptResults(jsonRes)}
+		return result, result.Scripts.Err()
+	} else if err != nil {
+		return FindResult{}, err
 	}
 
-	var records []Record
+	var result = FindResult{
+		DataInfo: jsonRes.Response.DataInfo,
+		Scripts:  newScriptResults(jsonRes),
+	}
 
 	for _, r := range jsonRes.Response.Data {
-		records = append(records, newRecord(layout, r, *s))
+		result.Records = append(result.Records, newRecord(layout, r, s))
+	}
+
+	return result, result.Scripts.Err()
+}
+
+/*
+SetGlobals sets the values of global fields for the session, which persist until the session is
+destroyed. The values are kept and set again when the session logs in again after its token has
+expired. The field names need to be fully qualified, i.e. `Table::Field`, with repetitions
+specified as `Table::Field(2)`. Numbers and bools are converted the same way as by Record.Set,
+while times are always formatted as US timestamps, regardless of WithDateFormat.
+*/
+func (s *Session) SetGlobals(fields map[string]interface{}) error {
+	return s.SetGlobalsContext(context.Background(), fields)
+}
+
+// SetGlobalsContext behaves like SetGlobals but sends the request using the specified context
+func (s *Session) SetGlobalsContext(ctx context.Context, fields map[string]interface{}) error {
+	var globalFields = make(map[string]interface{})
+	for fieldName, value := range fields {
+		if !strings.Contains(fieldName, "::") {
+			return fmt.Errorf("global field name is not fully qualified: %v", fieldName)
+		}
+		//The globals endpoint doesn't take the dateformats parameter, so times are always sent in US format
+		globalFields[fieldName] = formatValue(value, defaultDateLayouts)
+	}
+
+	//Create the request json body
+	requestBody, err := globalsBody(globalFields)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %v", err.Error())
+	}
+
+	_, err = s.request(
+		ctx,
+		"PATCH",
+		s.globalsURL(),
+		requestBody,
+		jsonHeader(),
+	)
+	if err != nil {
+		return err
+	}
+
+	//Keep the global fields, so they can be set again if the session expires
+	s.mu.Lock()
+	if s.globals == nil {
+		s.globals = make(map[string]interface{})
+	}
+	for fieldName, value := range globalFields {
+		s.globals[fieldName] = value
 	}
+	s.mu.Unlock()
 
-	return records, nil
+	return nil
+}
+
+// globalsURL returns the URL of the global fields of the session
+func (s *Session) globalsURL() string {
+	return fmt.Sprintf("%s/globals", s.baseURL())
+}
+
+// globalsBody returns the json body of the request setting the global fields
+func globalsBody(globalFields map[string]interface{}) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"globalFields": globalFields,
+	})
 }
 
 // NewRecord returns a new empty record for the specified layout
@@ -184,11 +518,41 @@ func (s *Session) NewRecord(layout string) Record {
 // LastActivity returns a time object representing the time of the last activity for
 // the session. Defaults as the time it was started if no other requests have been made.
 func (s *Session) LastActivity() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.lastActivity
 }
 
-// New starts a database session
-func New(host, database, username, password string) (*Session, error) {
+// newSession returns a session for the specified host configured by the specified options,
+// without logging in
+func newSession(host string, options []Option) *Session {
+	//Determine protocol scheme
+	if len(host) < 8 || host[:8] != "https://" {
+		host = fmt.Sprintf("https://%s", host)
+	}
+
+	session := &Session{Host: host}
+	for _, option := range options {
+		option(session)
+	}
+
+	//Apply the transport to a copy of the client, regardless of the order of the options
+	if session.transport != nil {
+		client := *session.httpClient()
+		client.Transport = session.transport
+		session.client = &client
+	}
+
+	return session
+}
+
+// New starts a database session, configured by any specified options
+func New(host, database, username, password string, options ...Option) (*Session, error) {
+	return NewContext(context.Background(), host, database, username, password, options...)
+}
+
+// NewContext behaves like New but sends the request using the specified context
+func NewContext(ctx context.Context, host, database, username, password string, options ...Option) (*Session, error) {
 	if host == "" {
 		return nil, errors.New("No host specified")
 	} else if database == "" {
@@ -197,61 +561,21 @@ func New(host, database, username, password string) (*Session, error) {
 		return nil, errors.New("No username specified")
 	}
 
-	//Create an empty json body
-	var requestBody, err = json.Marshal(struct{}{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %v", err.Error())
-	}
-
-	//Determine protocol scheme
-	if len(host) < 8 || host[:8] != "https://" {
-		host = fmt.Sprintf("https://%s", host)
-	}
-
-	//Build and send request to the host
-	req, err := http.NewRequest(
-		"POST",
-		fmt.Sprintf("%s/fmi/data/v1/databases/%s/sessions", host, database),
-		bytes.NewBuffer(requestBody),
-	)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add(
-		"Authorization",
-		"Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
-	)
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send POST request: %v", err.Error())
-	}
+	//Apply the options to the session
+	session := newSession(host, options)
+	session.Database = database
+	session.Username = username
+	session.Password = password
 
-	//Read the body
-	resBodyBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err.Error())
+	if err := session.checkDateFormat(); err != nil {
+		return nil, err
 	}
 
-	//Unmarshal json body
-	var jsonRes ResponseBody
-	err = json.Unmarshal(resBodyBytes, &jsonRes)
+	token, err := session.login(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode response body as json: %v", err.Error())
+		return nil, err
 	}
+	session.Token = token
 
-	//Check the response code
-	if jsonRes.Messages[0].Code != "0" {
-		return nil, fmt.Errorf(
-			"failed at host: %v (%v)",
-			jsonRes.Messages[0].Message,
-			jsonRes.Messages[0].Code,
-		)
-	}
-
-	return &Session{
-		Token:        jsonRes.Response.Token,
-		Host:         host,
-		Database:     database,
-		Username:     username,
-		Password:     password,
-		lastActivity: time.Now(),
-	}, nil
+	return session, nil
 }
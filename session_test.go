@@ -0,0 +1,569 @@
+package filemaker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a test server responding to the session endpoint with a new token for each
+// login and handing every other request to the specified handler
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *Session) {
+	logins := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/sessions") {
+			logins++
+			fmt.Fprintf(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"token":"token%d"}}`, logins)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	session, err := New(server.URL, "database", "username", "password", WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+
+	return server, session
+}
+
+// TestSessionReauthenticate tests that requests are retried with a new token when the token has expired
+func TestSessionReauthenticate(t *testing.T) {
+	var authorizations []string
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"messages":[{"code":"952","message":"Invalid FileMaker Data API token (*)"}],"response":{}}`)
+			return
+		}
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"data":[{"recordId":"1","modId":"0","fieldData":{"Name":"Mark"}}]}}`)
+	})
+
+	records, err := session.Find("layout", NewFindCommand(NewFindRequest(NewFindCriterion("Name", "Mark"))))
+	if err != nil {
+		t.Fatalf("failed to perform find: %v", err)
+	}
+
+	t.Run("records", func(t *testing.T) {
+		if len(records) != 1 || records[0].String("Name") != "Mark" {
+			t.Errorf("got: %v, expected: 1 record", records)
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		got := session.Token
+		expect := "token2"
+		if got != expect {
+			t.Errorf("got: '%v', expected: '%v'", got, expect)
+		}
+	})
+
+	t.Run("attempts", func(t *testing.T) {
+		got := strings.Join(authorizations, ", ")
+		expect := "Bearer token1, Bearer token2"
+		if got != expect {
+			t.Errorf("got: '%v', expected: '%v'", got, expect)
+		}
+	})
+}
+
+// TestSessionContext tests that requests are cancelled with their context, including requests
+// retried after logging in again
+func TestSessionContext(t *testing.T) {
+	release := make(chan struct{})
+	var expired int32
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&expired) == 1 && r.Header.Get("Authorization") == "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"messages":[{"code":"952","message":"Invalid FileMaker Data API token (*)"}],"response":{}}`)
+			return
+		}
+
+		//Block until the test is done, the client has to give up by itself
+		<-release
+	})
+	t.Cleanup(func() { close(release) })
+	command := NewFindCommand(NewFindRequest(NewFindCriterion("Name", "Mark")))
+
+	t.Run("find_deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := session.FindContext(ctx, "layout", command); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got: %v, expected: %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("commit_cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		record := session.NewRecord("layout")
+		record.ID = "1"
+		record.Set("Name", "Mark")
+		if err := record.CommitContext(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("got: %v, expected: %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("retry_deadline", func(t *testing.T) {
+		atomic.StoreInt32(&expired, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := session.FindContext(ctx, "layout", command); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got: %v, expected: %v", err, context.DeadlineExceeded)
+		}
+		if got := session.token(); got != "token2" {
+			t.Errorf("got: '%v', expected: '%v'", got, "token2")
+		}
+	})
+}
+
+// TestSessionError tests that failures at the host are returned as typed errors
+func TestSessionError(t *testing.T) {
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"messages":[{"code":"301","message":"Record is in use by another user"}],"response":{}}`)
+	})
+
+	record := session.NewRecord("layout")
+	record.ID = "1"
+	record.Set("Name", "Mark")
+	err := record.Commit()
+
+	t.Run("is", func(t *testing.T) {
+		if !errors.Is(err, ErrRecordLocked) {
+			t.Errorf("got: %v, expected: %v", err, ErrRecordLocked)
+		}
+		if errors.Is(err, ErrFieldValidation) {
+			t.Errorf("got: %v, expected not to match: %v", err, ErrFieldValidation)
+		}
+	})
+
+	t.Run("as", func(t *testing.T) {
+		var fmErr *Error
+		if !errors.As(err, &fmErr) {
+			t.Fatalf("got: %T, expected: %T", err, fmErr)
+		}
+		if fmErr.Code != 301 || fmErr.StatusCode != http.StatusInternalServerError || fmErr.Method != "PATCH" {
+			t.Errorf("got: %+v", fmErr)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		if !errors.Is(&Error{Code: 507}, ErrFieldValidation) {
+			t.Errorf("expected error 507 to match %v", ErrFieldValidation)
+		}
+	})
+}
+
+// TestSessionGetRecord tests getting a single record by ID
+func TestSessionGetRecord(t *testing.T) {
+	var query string
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Encode()
+		if strings.HasSuffix(r.URL.Path, "/records/1") {
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"data":[{"recordId":"1","modId":"3","fieldData":{"Name":"Mark"}}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"messages":[{"code":"101","message":"Record is missing"}],"response":{}}`)
+	})
+
+	t.Run("found", func(t *testing.T) {
+		record, err := session.GetRecord("layout", "1", NewGetOptions().Portals("Lines").PortalLimit("Lines", 5))
+		if err != nil {
+			t.Fatalf("failed to get record: %v", err)
+		}
+		if record.ID != "1" || record.String("Name") != "Mark" {
+			t.Errorf("got: %+v", record)
+		}
+		expect := "_limit.Lines=5&portal=%5B%22Lines%22%5D"
+		if query != expect {
+			t.Errorf("got: '%v', expected: '%v'", query, expect)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := session.GetRecord("layout", "2")
+		if !errors.Is(err, ErrRecordMissing) {
+			t.Errorf("got: %v, expected: %v", err, ErrRecordMissing)
+		}
+	})
+}
+
+// TestSessionFindWithInfo tests that the information about the found set is returned with the records
+func TestSessionFindWithInfo(t *testing.T) {
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"dataInfo":{"database":"database",`+
+			`"layout":"layout","table":"Heroes","totalRecordCount":120,"foundCount":40,"returnedCount":2},"data":[`+
+			`{"recordId":"1","modId":"0","fieldData":{"Name":"Anna"}},`+
+			`{"recordId":"2","modId":"0","fieldData":{"Name":"Mark"}}]}}`)
+	})
+
+	result, err := session.FindWithInfo("layout", NewFindCommand(NewFindRequest(NewFindCriterion("Name", "*"))).Limit(2))
+	if err != nil {
+		t.Fatalf("failed to perform find: %v", err)
+	}
+
+	expect := DataInfo{
+		Database:         "database",
+		Layout:           "layout",
+		Table:            "Heroes",
+		TotalRecordCount: 120,
+		FoundCount:       40,
+		ReturnedCount:    2,
+	}
+	if result.DataInfo != expect {
+		t.Errorf("got: %+v, expected: %+v", result.DataInfo, expect)
+	}
+	if len(result.Records) != 2 || result.Records[1].String("Name") != "Mark" {
+		t.Errorf("got: %v, expected: 2 records", result.Records)
+	}
+}
+
+// TestSessionGetRecords tests getting a range of records with paging and sort options
+func TestSessionGetRecords(t *testing.T) {
+	var query url.Values
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if query.Get("_offset") == "100" && query.Get("script.presort") != "" {
+			fmt.Fprint(w, `{"messages":[{"code":"401","message":"No records match the request"}],"response":{"scriptResult.presort":"missing","scriptError.presort":"104"}}`)
+			return
+		} else if query.Get("_offset") == "100" {
+			fmt.Fprint(w, `{"messages":[{"code":"401","message":"No records match the request"}],"response":{}}`)
+			return
+		}
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"data":[`+
+			`{"recordId":"1","modId":"0","fieldData":{"Name":"Anna"}},`+
+			`{"recordId":"2","modId":"0","fieldData":{"Name":"Mark"}}]}}`)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		records, err := session.GetRecords(
+			"layout",
+			NewGetOptions().Offset(11).Limit(2).Sort(NewSortField("Name", SortAscend), NewSortField("Age", SortDescend)),
+		)
+		if err != nil {
+			t.Fatalf("failed to get records: %v", err)
+		}
+		if len(records) != 2 || records[0].String("Name") != "Anna" || records[1].ID != "2" {
+			t.Errorf("got: %+v, expected: 2 records", records)
+		}
+
+		expect := map[string]string{
+			"_offset": "11",
+			"_limit":  "2",
+			"_sort":   `[{"fieldName":"Name","sortOrder":"ascend"},{"fieldName":"Age","sortOrder":"descend"}]`,
+		}
+		for key, value := range expect {
+			if got := query.Get(key); got != value {
+				t.Errorf("%v: got: '%v', expected: '%v'", key, got, value)
+			}
+		}
+	})
+
+	t.Run("scripts", func(t *testing.T) {
+		result, err := session.GetRecordsWithInfo("layout", NewGetOptions().Offset(100).PresortScript("Presort", ""))
+
+		var scriptErr *ScriptError
+		if !errors.As(err, &scriptErr) || scriptErr.Phase != "script.presort" || scriptErr.Code != 104 {
+			t.Errorf("got: %v, expected: presort script error 104", err)
+		}
+		if len(result.Records) != 0 || result.Scripts.PresortResult != "missing" {
+			t.Errorf("got: %+v", result)
+		}
+	})
+
+	t.Run("no_records", func(t *testing.T) {
+		records, err := session.GetRecords("layout", NewGetOptions().Offset(100))
+		if err != nil || records == nil || len(records) != 0 {
+			t.Errorf("got: %v (%v), expected: empty slice", records, err)
+		}
+	})
+}
+
+// TestRecordCommitPortal tests committing staged changes to related records
+func TestRecordCommitPortal(t *testing.T) {
+	var body map[string]interface{}
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			json.NewDecoder(r.Body).Decode(&body)
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"modId":"5"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"data":[{"recordId":"1","modId":"5","fieldData":{},"portalData":{"Lines":[{"recordId":"10","modId":"1","Lines::Qty":4},{"recordId":"12","modId":"0","Lines::Qty":1}]}}]}}`)
+	})
+
+	record := newRecord(
+		"layout",
+		map[string]interface{}{
+			"recordId":  "1",
+			"modId":     "4",
+			"fieldData": map[string]interface{}{},
+			"portalData": map[string]interface{}{
+				"Lines": []interface{}{
+					map[string]interface{}{"recordId": "10", "modId": "0", "Lines::Qty": float64(3)},
+					map[string]interface{}{"recordId": "11", "modId": "0", "Lines::Qty": float64(5)},
+				},
+			},
+			"portalDataInfo": []interface{}{
+				map[string]interface{}{"portalObjectName": "Lines", "table": "LineItems"},
+			},
+		},
+		session,
+	)
+	record.SetPortalRow("Lines", "10", "Lines::Qty", 4)
+	record.AddPortalRow("Lines", map[string]interface{}{"Lines::Qty": 1})
+	record.DeletePortalRow("Lines", "11")
+
+	if err := record.Commit(); err != nil {
+		t.Fatalf("failed to commit record: %v", err)
+	}
+
+	t.Run("body", func(t *testing.T) {
+		b, _ := json.Marshal(body)
+		got := string(b)
+		expect := `{"fieldData":{"deleteRelated":"LineItems.11"},"portalData":{"Lines":[{"Lines::Qty":4,"recordId":"10"},{"Lines::Qty":1}]}}`
+		if got != expect {
+			t.Errorf("got: '%v', expected: '%v'", got, expect)
+		}
+	})
+
+	t.Run("refreshed", func(t *testing.T) {
+		rows := record.Portal("Lines")
+		if len(rows) != 2 || rows[1].ID != "12" || len(rows[0].StagedChanges) != 0 {
+			t.Errorf("got: %+v", rows)
+		}
+	})
+}
+
+// TestRecordCommitChecked tests committing with the modification ID of the record
+func TestRecordCommitChecked(t *testing.T) {
+	modID := "5"
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			var body struct {
+				ModID string `json:"modId"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.ModID != modID {
+				fmt.Fprint(w, `{"messages":[{"code":"306","message":"Record modification ID does not match"}],"response":{}}`)
+				return
+			}
+			modID = "6"
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"modId":"6"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"data":[{"recordId":"1","modId":"%s","fieldData":{"Name":"Anna","Age":30}}]}}`, modID)
+	})
+
+	record := newRecord(
+		"layout",
+		map[string]interface{}{
+			"recordId":  "1",
+			"modId":     "4",
+			"fieldData": map[string]interface{}{"Name": "Mark", "Age": float64(30)},
+		},
+		session,
+	)
+	record.Set("Age", 31)
+
+	t.Run("conflict", func(t *testing.T) {
+		err := record.CommitChecked()
+		if !errors.Is(err, ErrModIDMismatch) {
+			t.Errorf("got: %v, expected: %v", err, ErrModIDMismatch)
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		if err := record.Reload(); err != nil {
+			t.Fatalf("failed to reload record: %v", err)
+		}
+		if record.ModID != "5" || record.String("Name") != "Anna" || record.Int("Age") != 31 {
+			t.Errorf("got: %+v", record)
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		if err := record.CommitChecked(); err != nil {
+			t.Fatalf("failed to commit record: %v", err)
+		}
+		if record.ModID != "6" {
+			t.Errorf("got: '%v', expected: '%v'", record.ModID, "6")
+		}
+	})
+}
+
+// TestScripts tests running scripts as part of finding and deleting records
+func TestScripts(t *testing.T) {
+	var query string
+	var body map[string]interface{}
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Encode()
+		if r.Method == "DELETE" {
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"scriptResult":"deleted","scriptError":"0"}}`)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if strings.Contains(r.URL.Path, "/layouts/empty/") {
+			fmt.Fprint(w, `{"messages":[{"code":"401","message":"No records match the request"}],"response":{"scriptResult.prerequest":"missing","scriptError.prerequest":"104"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"scriptResult.prerequest":"ok","scriptError.prerequest":"0","scriptError":"3","data":[{"recordId":"1","modId":"0","fieldData":{}}]}}`)
+	})
+
+	t.Run("find", func(t *testing.T) {
+		result, err := session.FindWithInfo(
+			"layout",
+			NewFindCommand().PrerequestScript("Before", "1").Script("After", ""),
+		)
+
+		var scriptErr *ScriptError
+		if !errors.As(err, &scriptErr) || scriptErr.Phase != "script" || scriptErr.Code != 3 {
+			t.Errorf("got: %v, expected: script error 3", err)
+		}
+		if len(result.Records) != 1 || result.Scripts.PrerequestResult != "ok" {
+			t.Errorf("got: %+v", result)
+		}
+		if body["script.prerequest"] != "Before" || body["script.prerequest.param"] != "1" || body["script"] != "After" {
+			t.Errorf("got: %v", body)
+		}
+	})
+
+	t.Run("find_no_records", func(t *testing.T) {
+		result, err := session.FindWithInfo("empty", NewFindCommand().PrerequestScript("Missing", ""))
+
+		var scriptErr *ScriptError
+		if !errors.As(err, &scriptErr) || scriptErr.Phase != "script.prerequest" || scriptErr.Code != 104 {
+			t.Errorf("got: %v, expected: prerequest script error 104", err)
+		}
+		if result.Records == nil || len(result.Records) != 0 || result.Scripts.PrerequestResult != "missing" {
+			t.Errorf("got: %+v", result)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		record := session.NewRecord("layout")
+		record.ID = "1"
+		record.ModID = "3"
+		record.SetScript("After Delete", "param")
+		if err := record.Delete(); err != nil {
+			t.Fatalf("failed to delete record: %v", err)
+		}
+		if record.ID != "" || record.ModID != "" {
+			t.Errorf("got: '%v' and '%v', expected empty IDs", record.ID, record.ModID)
+		}
+		if expect := "script=After+Delete&script.param=param"; query != expect {
+			t.Errorf("got: '%v', expected: '%v'", query, expect)
+		}
+		if record.ScriptResults.Result != "deleted" {
+			t.Errorf("got: %+v", record.ScriptResults)
+		}
+	})
+}
+
+// TestSessionRunScript tests running a script without touching any records
+func TestSessionRunScript(t *testing.T) {
+	var uri string
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		uri = r.URL.RequestURI()
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"scriptResult":"42","scriptError":"0"}}`)
+	})
+
+	result, err := session.RunScript("My Layout", "Calculate/Sum", "a&b")
+	if err != nil {
+		t.Fatalf("failed to run script: %v", err)
+	}
+
+	t.Run("result", func(t *testing.T) {
+		if result != "42" {
+			t.Errorf("got: '%v', expected: '%v'", result, "42")
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		expect := "/fmi/data/v1/databases/database/layouts/My%20Layout/script/Calculate%2FSum?script.param=a%26b"
+		if uri != expect {
+			t.Errorf("got: '%v', expected: '%v'", uri, expect)
+		}
+	})
+}
+
+// TestSessionSetGlobals tests setting the values of global fields
+func TestSessionSetGlobals(t *testing.T) {
+	var body string
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = r.Method + " " + r.URL.Path + " " + string(b)
+		fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{}}`)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		err := session.SetGlobals(map[string]interface{}{"Settings::gYear(2)": 2022, "Settings::gActive": true})
+		if err != nil {
+			t.Fatalf("failed to set globals: %v", err)
+		}
+		expect := `PATCH /fmi/data/v1/databases/database/globals {"globalFields":{"Settings::gActive":1,"Settings::gYear(2)":2022}}`
+		if body != expect {
+			t.Errorf("got: '%v', expected: '%v'", body, expect)
+		}
+	})
+
+	t.Run("unqualified", func(t *testing.T) {
+		if err := session.SetGlobals(map[string]interface{}{"gYear": 2022}); err == nil {
+			t.Errorf("expected error for unqualified field name")
+		}
+	})
+}
+
+// TestSessionSetGlobalsReauthenticate tests that global fields are set again after the session
+// logs in again, so requests depending on them keep working
+func TestSessionSetGlobalsReauthenticate(t *testing.T) {
+	globals := make(map[string]string)
+	expired := false
+	_, session := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if expired && token == "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"messages":[{"code":"952","message":"Invalid FileMaker Data API token (*)"}],"response":{}}`)
+			return
+		}
+		if r.Method == "PATCH" {
+			b, _ := ioutil.ReadAll(r.Body)
+			globals[token] = string(b)
+			fmt.Fprint(w, `{"messages":[{"code":"0","message":"OK"}],"response":{}}`)
+			return
+		}
+
+		//Respond with the global fields of the session, like a calculation depending on them
+		b, _ := json.Marshal(globals[token])
+		fmt.Fprintf(w, `{"messages":[{"code":"0","message":"OK"}],"response":{"data":[`+
+			`{"recordId":"1","modId":"0","fieldData":{"Globals":%s}}]}}`, b)
+	})
+
+	if err := session.SetGlobals(map[string]interface{}{"Settings::gYear": 2022}); err != nil {
+		t.Fatalf("failed to set globals: %v", err)
+	}
+	expired = true
+
+	record, err := session.GetRecord("layout", "1")
+	if err != nil {
+		t.Fatalf("failed to get record: %v", err)
+	}
+
+	got := record.String("Globals")
+	expect := `{"globalFields":{"Settings::gYear":2022}}`
+	if session.Token != "token2" || got != expect {
+		t.Errorf("got: '%v' with %v, expected: '%v' with token2", got, session.Token, expect)
+	}
+}
@@ -0,0 +1,23 @@
+package filemaker
+
+const (
+	//SortAscend sorts the records in ascending order
+	SortAscend = "ascend"
+	//SortDescend sorts the records in descending order
+	SortDescend = "descend"
+)
+
+// SortField represents a field that records are sorted by
+type SortField struct {
+	FieldName string `json:"fieldName"`
+	SortOrder string `json:"sortOrder,omitempty"`
+}
+
+// NewSortField returns a new sortfield. The sort order is either SortAscend, SortDescend or the
+// name of a value list, sorting the records in the order of the values in the value list.
+func NewSortField(fieldName, sortOrder string) SortField {
+	return SortField{
+		fieldName,
+		sortOrder,
+	}
+}